@@ -0,0 +1,60 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/consumption/armconsumption"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierBudgets = "budgets:%s"
+)
+
+// ListCachedBudgets return cached list of Azure consumption budgets for subscription
+func (azureClient *ArmClient) ListCachedBudgets(ctx context.Context, subscriptionID string) ([]*armconsumption.Budget, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierBudgets, subscriptionID), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure Budget list")
+		list, err := azureClient.ListBudgets(ctx, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure Budgets", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*armconsumption.Budget), nil
+}
+
+// ListBudgets return list of Azure consumption budgets (incl. amount, current spend and notifications) for subscription
+func (azureClient *ArmClient) ListBudgets(ctx context.Context, subscriptionID string) ([]*armconsumption.Budget, error) {
+	list := []*armconsumption.Budget{}
+
+	client, err := armconsumption.NewBudgetsClient(azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListPager(fmt.Sprintf("/subscriptions/%s", subscriptionID), nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierBudgets, subscriptionID), list)
+
+	return list, nil
+}
@@ -0,0 +1,137 @@
+package armclient
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+)
+
+type (
+	cacheLruDef struct {
+		lock       sync.Mutex
+		maxEntries int
+		list       *list.List
+		items      map[string]*list.Element
+	}
+)
+
+// SetCacheMaxEntries set maximum number of entries in service discovery cache, least recently used entries are evicted (0 disables limit)
+func (azureClient *ArmClient) SetCacheMaxEntries(maxEntries int) {
+	azureClient.cacheLru.lock.Lock()
+	azureClient.cacheLru.maxEntries = maxEntries
+	if maxEntries > 0 && azureClient.cacheLru.list == nil {
+		azureClient.cacheLru.list = list.New()
+		azureClient.cacheLru.items = map[string]*list.Element{}
+
+		// track existing entries
+		for key := range azureClient.cache.Items() {
+			azureClient.cacheLru.items[key] = azureClient.cacheLru.list.PushFront(key)
+		}
+	} else if maxEntries <= 0 {
+		azureClient.cacheLru.list = nil
+		azureClient.cacheLru.items = nil
+	}
+	azureClient.cacheLru.lock.Unlock()
+
+	azureClient.cacheEvict()
+}
+
+// cacheGet returns entry from cache and marks it as recently used
+func (azureClient *ArmClient) cacheGet(key string) (interface{}, bool) {
+	val, exists := azureClient.cache.Get(key)
+	if exists {
+		azureClient.cacheTouch(key)
+	}
+	return val, exists
+}
+
+// cacheSetDefault stores entry in cache with default expiration
+func (azureClient *ArmClient) cacheSetDefault(key string, val interface{}) {
+	azureClient.cacheSet(key, val, cache.DefaultExpiration)
+}
+
+// cacheSet stores entry in cache with expiration and evicts least recently used entries if needed
+func (azureClient *ArmClient) cacheSet(key string, val interface{}, ttl time.Duration) {
+	azureClient.cache.Set(key, val, ttl)
+	azureClient.cacheTouch(key)
+	azureClient.cacheEvict()
+}
+
+// cacheDelete removes entry from cache
+func (azureClient *ArmClient) cacheDelete(key string) {
+	azureClient.cache.Delete(key)
+}
+
+// cacheFlush removes all entries from cache
+func (azureClient *ArmClient) cacheFlush() {
+	// delete entries one by one, cache calls cacheUntrack on deletion (Flush does not)
+	for key := range azureClient.cache.Items() {
+		azureClient.cache.Delete(key)
+	}
+}
+
+// cacheTouch marks cache entry as recently used
+func (azureClient *ArmClient) cacheTouch(key string) {
+	azureClient.cacheLru.lock.Lock()
+	defer azureClient.cacheLru.lock.Unlock()
+
+	if azureClient.cacheLru.list == nil {
+		return
+	}
+
+	if element, exists := azureClient.cacheLru.items[key]; exists {
+		azureClient.cacheLru.list.MoveToFront(element)
+	} else {
+		azureClient.cacheLru.items[key] = azureClient.cacheLru.list.PushFront(key)
+	}
+}
+
+// cacheUntrack removes entry from LRU tracking (called by cache if entry was deleted or expired)
+func (azureClient *ArmClient) cacheUntrack(key string, _ interface{}) {
+	azureClient.cacheLru.lock.Lock()
+	defer azureClient.cacheLru.lock.Unlock()
+
+	if azureClient.cacheLru.list == nil {
+		return
+	}
+
+	if element, exists := azureClient.cacheLru.items[key]; exists {
+		azureClient.cacheLru.list.Remove(element)
+		delete(azureClient.cacheLru.items, key)
+	}
+}
+
+// cacheEvict removes least recently used entries if cache exceeds max entries
+func (azureClient *ArmClient) cacheEvict() {
+	evictList := []string{}
+
+	azureClient.cacheLru.lock.Lock()
+	if azureClient.cacheLru.list != nil {
+		for azureClient.cacheLru.list.Len() > azureClient.cacheLru.maxEntries {
+			element := azureClient.cacheLru.list.Back()
+			key := element.Value.(string)
+			azureClient.cacheLru.list.Remove(element)
+			delete(azureClient.cacheLru.items, key)
+			evictList = append(evictList, key)
+		}
+	}
+	azureClient.cacheLru.lock.Unlock()
+
+	// delete outside of lock, cache calls cacheUntrack on deletion
+	for _, key := range evictList {
+		azureClient.cache.Delete(key)
+	}
+}
+
+// cacheCopyMap returns shallow copy of cached map, so callers can add or remove entries without modifying the cache
+//
+//	elements are shared with the cache and are treated as immutable
+func cacheCopyMap[K comparable, V any](val map[K]V) map[K]V {
+	ret := make(map[K]V, len(val))
+	for key, value := range val {
+		ret[key] = value
+	}
+	return ret
+}
@@ -0,0 +1,159 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+func Test_CacheMaxEntries(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetCacheMaxEntries(3)
+
+	for i := 0; i < 3; i++ {
+		client.cacheSetDefault(fmt.Sprintf("key%d", i), i)
+	}
+
+	// mark key0 as recently used, key1 is now least recently used
+	if _, exists := client.cacheGet("key0"); !exists {
+		t.Fatalf(`expected key0 to exist`)
+	}
+
+	client.cacheSetDefault("key3", 3)
+
+	if client.cache.ItemCount() != 3 {
+		t.Fatalf(`expected 3 cache entries, got %v`, client.cache.ItemCount())
+	}
+
+	if _, exists := client.cacheGet("key1"); exists {
+		t.Fatalf(`expected least recently used key1 to be evicted`)
+	}
+
+	for _, key := range []string{"key0", "key2", "key3"} {
+		if _, exists := client.cacheGet(key); !exists {
+			t.Fatalf(`expected %v to exist`, key)
+		}
+	}
+
+	// deleted entries are not tracked anymore
+	client.cacheDelete("key0")
+	client.cacheSetDefault("key4", 4)
+	if client.cache.ItemCount() != 3 {
+		t.Fatalf(`expected 3 cache entries after delete, got %v`, client.cache.ItemCount())
+	}
+}
+
+func Test_CacheCopyMap(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.cacheSetDefault(CacheIdentifierSubscriptions, map[string]*armsubscriptions.Subscription{
+		"d7b0cf13-ddf7-43ea-81f1-6f659767a318": {
+			SubscriptionID: to.StringPtr("d7b0cf13-ddf7-43ea-81f1-6f659767a318"),
+			DisplayName:    to.StringPtr("foo"),
+			Tags:           map[string]*string{"owner": to.StringPtr("team-a")},
+		},
+	})
+
+	list, err := client.ListCachedSubscriptions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// modify returned list
+	delete(list, "d7b0cf13-ddf7-43ea-81f1-6f659767a318")
+	list["6e3ea4e1-a7ee-4c6d-b1b4-5d2a2c3b8f6e"] = &armsubscriptions.Subscription{SubscriptionID: to.StringPtr("6e3ea4e1-a7ee-4c6d-b1b4-5d2a2c3b8f6e")}
+
+	cachedList, err := client.ListCachedSubscriptions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cachedList) != 1 {
+		t.Fatalf(`expected 1 cached subscription, got %v`, len(cachedList))
+	}
+	if _, exists := cachedList["d7b0cf13-ddf7-43ea-81f1-6f659767a318"]; !exists {
+		t.Fatalf(`expected cached subscription to exist`)
+	}
+}
+
+func Test_CacheDataOperationTimeout(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetDefaultOperationTimeout(1 * time.Minute)
+
+	// context without deadline gets default operation timeout
+	if _, err := client.cacheData(context.Background(), "key0", func(ctx context.Context) (interface{}, error) {
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			t.Fatalf(`expected context with deadline`)
+		}
+		return 0, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// existing deadline is kept
+	deadline := time.Now().Add(5 * time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if _, err := client.cacheData(ctx, "key1", func(ctx context.Context) (interface{}, error) {
+		if ctxDeadline, _ := ctx.Deadline(); !ctxDeadline.Equal(deadline) {
+			t.Fatalf(`expected context deadline %v, got %v`, deadline, ctxDeadline)
+		}
+		return 1, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ReloadCloudConfig(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetCacheMaxEntries(10)
+	client.cacheSetDefault("key0", 0)
+
+	chinaCloudConfig, err := cloudconfig.NewCloudConfig("AzureChinaCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ReloadCloudConfig(chinaCloudConfig)
+
+	if name := client.GetCloudName(); name != cloudconfig.AzureChinaCloud {
+		t.Fatalf(`expected cloud %v, got %v`, cloudconfig.AzureChinaCloud, name)
+	}
+
+	if endpoint := client.NewArmClientOptions().Cloud.Services[cloud.ResourceManager].Endpoint; endpoint != chinaCloudConfig.Services[cloud.ResourceManager].Endpoint {
+		t.Fatalf(`expected client options with ResourceManager endpoint %v, got %v`, chinaCloudConfig.Services[cloud.ResourceManager].Endpoint, endpoint)
+	}
+
+	if count := client.cache.ItemCount(); count != 0 {
+		t.Fatalf(`expected empty cache after reload, got %v entries`, count)
+	}
+	if count := client.cacheLru.list.Len(); count != 0 {
+		t.Fatalf(`expected no tracked cache entries after reload, got %v`, count)
+	}
+}
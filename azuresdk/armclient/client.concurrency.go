@@ -0,0 +1,42 @@
+package armclient
+
+import (
+	"context"
+)
+
+// SetGlobalConcurrency sets maximum number of concurrent iterator callbacks (SubscriptionsIterator.ForEach and
+// SubscriptionsIterator.ForEachAsync) across all iterators of this client, independent of the iterator concurrency (0 disables the limit)
+//
+//	a slot is held while a callback is running, iterators of this client must not be nested
+//	(nested callbacks would wait for slots held by the outer callbacks),
+//	changing the limit only applies to callbacks started afterwards
+func (azureClient *ArmClient) SetGlobalConcurrency(concurrency int) {
+	azureClient.globalConcurrencyLock.Lock()
+	defer azureClient.globalConcurrencyLock.Unlock()
+
+	if concurrency > 0 {
+		azureClient.globalConcurrency = make(chan struct{}, concurrency)
+	} else {
+		azureClient.globalConcurrency = nil
+	}
+}
+
+// acquireGlobalConcurrency waits for a free slot of the global concurrency limit (or ctx is done) and returns the release func
+func (azureClient *ArmClient) acquireGlobalConcurrency(ctx context.Context) (func(), error) {
+	azureClient.globalConcurrencyLock.RLock()
+	semaphore := azureClient.globalConcurrency
+	azureClient.globalConcurrencyLock.RUnlock()
+
+	if semaphore == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case semaphore <- struct{}{}:
+		return func() {
+			<-semaphore
+		}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,272 @@
+package armclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/costmanagement/armcostmanagement"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	CacheIdentifierCostQuery = "costs:%s:%s:%s"
+
+	// cost data is only updated a few times per day
+	costCacheTtl = 6 * time.Hour
+
+	costManagementModulePath = "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/costmanagement/armcostmanagement"
+)
+
+const (
+	CostTimeframeMonthToDate         CostTimeframe = CostTimeframe(armcostmanagement.TimeframeTypeMonthToDate)
+	CostTimeframeBillingMonthToDate  CostTimeframe = CostTimeframe(armcostmanagement.TimeframeTypeBillingMonthToDate)
+	CostTimeframeTheLastMonth        CostTimeframe = CostTimeframe(armcostmanagement.TimeframeTypeTheLastMonth)
+	CostTimeframeTheLastBillingMonth CostTimeframe = CostTimeframe(armcostmanagement.TimeframeTypeTheLastBillingMonth)
+	CostTimeframeWeekToDate          CostTimeframe = CostTimeframe(armcostmanagement.TimeframeTypeWeekToDate)
+)
+
+var (
+	// costQueryPollInterval is the wait time between polls of async cost queries if no Retry-After header is returned
+	costQueryPollInterval = 10 * time.Second
+)
+
+type (
+	CostTimeframe string
+
+	CostRow struct {
+		Cost     float64
+		Currency string
+		Groups   map[string]string
+	}
+)
+
+// QueryCachedCost return cached cost query result for scope, timeframe and grouping (dimension names)
+func (azureClient *ArmClient) QueryCachedCost(ctx context.Context, scope string, timeframe CostTimeframe, grouping []string) ([]CostRow, error) {
+	cacheKey := fmt.Sprintf(CacheIdentifierCostQuery, strings.ToLower(scope), timeframe, strings.Join(grouping, ","))
+	if v, ok := azureClient.cacheGet(cacheKey); ok {
+		return v.([]CostRow), nil
+	}
+
+	azureClient.logger.With(zap.String("scope", scope)).Debug("updating cached Azure cost query")
+	list, err := azureClient.QueryCost(ctx, scope, timeframe, grouping)
+	if err != nil {
+		return nil, err
+	}
+	azureClient.logger.With(zap.String("scope", scope)).Debugf("found %v Azure cost rows", len(list))
+
+	return list, nil
+}
+
+// QueryCost queries actual costs for scope aggregated by grouping (dimension names, eg. ResourceGroupName)
+//
+//	scope can be any cost management scope (eg. /subscriptions/xxx, /subscriptions/xxx/resourceGroups/xxx,
+//	/providers/Microsoft.Management/managementGroups/xxx or /providers/Microsoft.Billing/billingAccounts/xxx),
+//	async queries (202 Accepted) are polled until the result is available
+func (azureClient *ArmClient) QueryCost(ctx context.Context, scope string, timeframe CostTimeframe, grouping []string) ([]CostRow, error) {
+	list := []CostRow{}
+
+	ctx, cancel := azureClient.operationContext(ctx)
+	defer cancel()
+
+	queryType := armcostmanagement.ExportTypeActualCost
+	queryTimeframe := armcostmanagement.TimeframeType(timeframe)
+	aggregationFunction := armcostmanagement.FunctionTypeSum
+	groupingType := armcostmanagement.QueryColumnTypeDimension
+
+	query := armcostmanagement.QueryDefinition{
+		Type:      &queryType,
+		Timeframe: &queryTimeframe,
+		Dataset: &armcostmanagement.QueryDataset{
+			Aggregation: map[string]*armcostmanagement.QueryAggregation{
+				"totalCost": {
+					Name:     to.StringPtr("Cost"),
+					Function: &aggregationFunction,
+				},
+			},
+		},
+	}
+	for _, name := range grouping {
+		query.Dataset.Grouping = append(query.Dataset.Grouping, &armcostmanagement.QueryGrouping{
+			Name: to.StringPtr(name),
+			Type: &groupingType,
+		})
+	}
+
+	cred := azureClient.costQueryCred(scope)
+
+	client, err := armcostmanagement.NewQueryClient(cred, azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	// QueryClient supports neither async queries nor next links, these requests are sent using an arm client with same options
+	pipelineClient, err := arm.NewClient("armcostmanagement.QueryClient", costManagementModuleVersion(), cred, azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+	pipeline := pipelineClient.Pipeline()
+
+	var result armcostmanagement.QueryResult
+	response, err := client.Usage(ctx, strings.Trim(scope, "/"), query, nil)
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusAccepted {
+			return nil, err
+		}
+
+		// async query, poll location until result is available
+		if result, err = azureClient.costQueryResult(ctx, pipeline, respErr.RawResponse); err != nil {
+			return nil, err
+		}
+	} else {
+		result = response.QueryResult
+	}
+
+	for result.Properties != nil {
+		list = append(list, costRowsFromQueryResult(result.Properties)...)
+
+		nextLink := to.String(result.Properties.NextLink)
+		if nextLink == "" {
+			break
+		}
+
+		req, err := runtime.NewRequest(ctx, http.MethodPost, nextLink)
+		if err != nil {
+			return nil, err
+		}
+		if err := runtime.MarshalAsJSON(req, query); err != nil {
+			return nil, err
+		}
+
+		resp, err := pipeline.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if result, err = azureClient.costQueryResult(ctx, pipeline, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	// update cache
+	azureClient.cacheSet(fmt.Sprintf(CacheIdentifierCostQuery, strings.ToLower(scope), timeframe, strings.Join(grouping, ",")), list, costCacheTtl)
+
+	return list, nil
+}
+
+// costQueryCred returns credential for cost query scope, subscription scopes use the credential of the subscription tenant
+func (azureClient *ArmClient) costQueryCred(scope string) azcore.TokenCredential {
+	if scopeInfo, err := ParseResourceId(scope); err == nil && scopeInfo.Subscription != "" {
+		return azureClient.GetCredForSubscription(scopeInfo.Subscription)
+	}
+
+	return azureClient.GetCred()
+}
+
+// costQueryResult waits for result of cost query if query is processed asynchronously (202 Accepted) and returns the result,
+// bodies of intermediate responses are drained and closed
+func (azureClient *ArmClient) costQueryResult(ctx context.Context, pipeline runtime.Pipeline, resp *http.Response) (armcostmanagement.QueryResult, error) {
+	result := armcostmanagement.QueryResult{}
+
+	for resp.StatusCode == http.StatusAccepted {
+		location := resp.Header.Get("Location")
+
+		wait := costQueryPollInterval
+		if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && retryAfter > 0 {
+			wait = time.Duration(retryAfter) * time.Second
+		}
+
+		runtime.Drain(resp)
+
+		if location == "" {
+			return result, fmt.Errorf(`cost query was accepted but no location header was returned`)
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		req, err := runtime.NewRequest(ctx, http.MethodGet, location)
+		if err != nil {
+			return result, err
+		}
+
+		resp, err = pipeline.Do(req)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if !runtime.HasStatusCode(resp, http.StatusOK, http.StatusNoContent) {
+		return result, runtime.NewResponseError(resp)
+	}
+
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// costManagementModuleVersion returns version of armcostmanagement module (telemetry of cost query requests)
+func costManagementModuleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == costManagementModulePath {
+				return dep.Version
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// costRowsFromQueryResult converts cost query columns/rows into CostRow list
+func costRowsFromQueryResult(result *armcostmanagement.QueryProperties) []CostRow {
+	list := []CostRow{}
+
+	columns := make([]string, len(result.Columns))
+	for num, column := range result.Columns {
+		columns[num] = to.String(column.Name)
+	}
+
+	for _, row := range result.Rows {
+		costRow := CostRow{
+			Groups: map[string]string{},
+		}
+
+		for num, value := range row {
+			if num >= len(columns) {
+				break
+			}
+
+			switch columnName := columns[num]; strings.ToLower(columnName) {
+			case "totalcost", "cost", "pretaxcost":
+				if val, ok := value.(float64); ok {
+					costRow.Cost = val
+				}
+			case "currency":
+				costRow.Currency = fmt.Sprintf("%v", value)
+			default:
+				costRow.Groups[columnName] = fmt.Sprintf("%v", value)
+			}
+		}
+
+		list = append(list, costRow)
+	}
+
+	return list
+}
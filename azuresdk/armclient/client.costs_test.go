@@ -0,0 +1,101 @@
+package armclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+// testCostQueryTransport fakes async cost query with next link and tracks response bodies
+type testCostQueryTransport struct {
+	lock     sync.Mutex
+	requests []string
+	bodies   []*testResponseBody
+}
+
+type testResponseBody struct {
+	io.Reader
+	closed bool
+}
+
+func (body *testResponseBody) Close() error {
+	body.closed = true
+	return nil
+}
+
+func (transport *testCostQueryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+
+	transport.requests = append(transport.requests, req.Method+" "+req.URL.Path)
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	content := ""
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/providers/Microsoft.CostManagement/query"):
+		resp.StatusCode = http.StatusAccepted
+		resp.Header.Set("Location", "https://management.azure.com/poll")
+		content = `{}`
+	case req.Method == http.MethodGet && req.URL.Path == "/poll":
+		content = `{"properties":{"nextLink":"https://management.azure.com/next?$skiptoken=test","columns":[{"name":"Cost"},{"name":"Currency"},{"name":"ResourceGroupName"}],"rows":[[1.5,"EUR","rg1"]]}}`
+	case req.Method == http.MethodPost && req.URL.Path == "/next":
+		content = `{"properties":{"columns":[{"name":"Cost"},{"name":"Currency"},{"name":"ResourceGroupName"}],"rows":[[2.5,"EUR","rg2"]]}}`
+	default:
+		resp.StatusCode = http.StatusNotFound
+	}
+
+	body := &testResponseBody{Reader: strings.NewReader(content)}
+	transport.bodies = append(transport.bodies, body)
+	resp.Body = body
+
+	return resp, nil
+}
+
+func Test_QueryCost(t *testing.T) {
+	costQueryPollInterval = 1 * time.Millisecond
+
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &testCostQueryTransport{}
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetHTTPClient(&http.Client{Transport: transport})
+	if err := client.UseCredentialChain(&testTokenCredential{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// management group scope (no subscription)
+	list, err := client.QueryCost(context.Background(), "/providers/Microsoft.Management/managementGroups/test", CostTimeframeMonthToDate, []string{"ResourceGroupName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].Cost != 1.5 || list[1].Cost != 2.5 || list[1].Currency != "EUR" || list[1].Groups["ResourceGroupName"] != "rg2" {
+		t.Fatalf(`unexpected cost rows: %+v`, list)
+	}
+
+	expectedRequests := []string{
+		"POST /providers/Microsoft.Management/managementGroups/test/providers/Microsoft.CostManagement/query",
+		"GET /poll",
+		"POST /next",
+	}
+	if strings.Join(transport.requests, ",") != strings.Join(expectedRequests, ",") {
+		t.Fatalf(`unexpected requests: %v`, transport.requests)
+	}
+
+	for num, body := range transport.bodies {
+		if !body.closed {
+			t.Fatalf(`expected body of response %v (%v) to be closed`, num, transport.requests[num])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+type (
+	CredentialAttempt struct {
+		Type    string
+		Success bool
+		Error   error
+	}
+)
+
+// DebugCredentialChain tries all credential types of the default credential chain (in order) and reports their individual results
+//
+//	order: environment, workload identity, managed identity, az cli
+func (azureClient *ArmClient) DebugCredentialChain(ctx context.Context) ([]CredentialAttempt, error) {
+	clientOptions := *azureClient.NewAzCoreClientOptions()
+
+	credentialChain := []struct {
+		name    string
+		factory func() (azcore.TokenCredential, error)
+	}{
+		{
+			name: "EnvironmentCredential",
+			factory: func() (azcore.TokenCredential, error) {
+				return azidentity.NewEnvironmentCredential(&azidentity.EnvironmentCredentialOptions{ClientOptions: clientOptions})
+			},
+		},
+		{
+			name: "WorkloadIdentityCredential",
+			factory: func() (azcore.TokenCredential, error) {
+				return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{ClientOptions: clientOptions})
+			},
+		},
+		{
+			name: "ManagedIdentityCredential",
+			factory: func() (azcore.TokenCredential, error) {
+				return azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions})
+			},
+		},
+		{
+			name: "AzureCLICredential",
+			factory: func() (azcore.TokenCredential, error) {
+				return azidentity.NewAzureCLICredential(nil)
+			},
+		},
+	}
+
+	success := false
+	attempts := []CredentialAttempt{}
+	for _, credential := range credentialChain {
+		attempt := CredentialAttempt{Type: credential.name}
+
+		if cred, err := credential.factory(); err == nil {
+			if _, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureClient.tokenScope()}}); err == nil {
+				attempt.Success = true
+				success = true
+			} else {
+				attempt.Error = err
+			}
+		} else {
+			attempt.Error = err
+		}
+
+		attempts = append(attempts, attempt)
+
+		if ctx.Err() != nil {
+			return attempts, ctx.Err()
+		}
+	}
+
+	if !success {
+		return attempts, fmt.Errorf(`no credential of the credential chain was able to get a token`)
+	}
+
+	return attempts, nil
+}
+
+// UseCredentialChain uses the credentials in order until one of them provides a token
+// (eg. workload identity, managed identity and client secret)
+func (azureClient *ArmClient) UseCredentialChain(creds ...azcore.TokenCredential) error {
+	if len(creds) == 0 {
+		return fmt.Errorf(`credential chain needs at least one credential`)
+	}
+
+	chain := make([]azcore.TokenCredential, len(creds))
+	copy(chain, creds)
+
+	cred, err := azidentity.NewChainedTokenCredential(chain, nil)
+	if err != nil {
+		return err
+	}
+
+	azureClient.credLock.Lock()
+	defer azureClient.credLock.Unlock()
+
+	azureClient.credMode = credModeChain
+	azureClient.credChain = chain
+	azureClient.setCred(cred)
+	return nil
+}
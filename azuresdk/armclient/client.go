@@ -2,15 +2,22 @@ package armclient
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
 	cache "github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/trace"
 	zap "go.uber.org/zap"
 
 	commonAzidentity "github.com/webdevops/go-common/azuresdk/azidentity"
@@ -19,20 +26,64 @@ import (
 	"github.com/webdevops/go-common/utils/to"
 )
 
+const (
+	credModeDefault = "default"
+	credModeAzCli   = "azcli"
+	credModeChain   = "chain"
+)
+
 type (
 	ArmClient struct {
 		TagManager *ArmClientTagManager
 
 		cloud cloudconfig.CloudEnvironment
 
+		// cloudLock guards cloud and cred (see ReloadCloudConfig)
+		cloudLock sync.RWMutex
+
+		// credLock serializes creation and replacement of cred (eg. RefreshCredential and ReloadCloudConfig)
+		credLock sync.Mutex
+
 		logger *zap.SugaredLogger
 
-		cache    *cache.Cache
-		cacheTtl time.Duration
+		cache       *cache.Cache
+		cacheLru    cacheLruDef
+		cacheTtl    time.Duration
+		sharedCache SharedCache
+
+		subscriptionFilter         []string
+		locationFilter             []string
+		subscriptionExcludedStates []armsubscriptions.SubscriptionState
+
+		connectSkipSubscriptionList bool
+
+		cred      *azcore.TokenCredential
+		credMode  string
+		credChain []azcore.TokenCredential
+
+		tenant struct {
+			lock          sync.RWMutex
+			creds         map[string]azcore.TokenCredential
+			subscriptions map[string]string
+		}
+
+		tlsConfig       *tls.Config
+		maxIdleConns    int
+		maxConnsPerHost int
+		httpClient      *http.Client
+		transport       *http.Client
+		transportLock   sync.Mutex
+
+		tracer trace.Tracer
+
+		tokenExpiry tokenExpiryCache
+
+		apiVersions apiVersionOverrides
 
-		subscriptionFilter []string
+		globalConcurrency     chan struct{}
+		globalConcurrencyLock sync.RWMutex
 
-		cred *azcore.TokenCredential
+		defaultOperationTimeout time.Duration
 
 		userAgent string
 	}
@@ -56,9 +107,19 @@ func NewArmClient(cloudConfig cloudconfig.CloudEnvironment, logger *zap.SugaredL
 
 	client.cacheTtl = 30 * time.Minute
 	client.cache = cache.New(60*time.Minute, 60*time.Second)
+	client.cache.OnEvicted(client.cacheUntrack)
+
+	client.tenant.creds = map[string]azcore.TokenCredential{}
+	client.tenant.subscriptions = map[string]string{}
 
 	client.logger = logger
 	client.userAgent = "go-common/unknown"
+	client.credMode = credModeDefault
+	client.subscriptionExcludedStates = []armsubscriptions.SubscriptionState{
+		armsubscriptions.SubscriptionStateDeleted,
+		armsubscriptions.SubscriptionStateDisabled,
+		armsubscriptions.SubscriptionStateWarned,
+	}
 
 	client.TagManager = &ArmClientTagManager{
 		client: client,
@@ -82,26 +143,32 @@ func NewArmClientWithCloudName(cloudName string, logger *zap.SugaredLogger) (*Ar
 func (azureClient *ArmClient) Connect() error {
 	ctx := context.Background()
 
+	cloudConfig := azureClient.getCloud()
 	azureClient.logger.Infof(
 		`connecting to Azure Environment "%v" (AzureAD:%s ResourceManager:%s)`,
-		azureClient.cloud.Name,
-		azureClient.cloud.ActiveDirectoryAuthorityHost,
-		azureClient.cloud.Services[cloud.ResourceManager].Endpoint,
+		cloudConfig.Name,
+		cloudConfig.ActiveDirectoryAuthorityHost,
+		cloudConfig.Services[cloud.ResourceManager].Endpoint,
 	)
 
 	// try to get token
-	scope := strings.TrimSuffix(azureClient.cloud.Services[cloud.ResourceManager].Endpoint, "/.default") + "/.default"
-	accessToken, err := azureClient.GetCred().GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+	accessToken, err := azureClient.GetCred().GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureClient.tokenScope()}})
 	if err != nil {
 		return err
 	}
 
 	if tokenInfo := commonAzidentity.ParseAccessToken(accessToken); tokenInfo != nil {
+		metricTokenExpiry.WithLabelValues(to.String(tokenInfo.AppId), to.String(tokenInfo.Tid)).Set(float64(accessToken.ExpiresOn.Unix()))
 		azureClient.logger.With(zap.Any("client", tokenInfo.ToMap())).Infof(`using Azure client: %v`, tokenInfo.ToString())
 	} else {
 		azureClient.logger.Warn(`unable to get Azure client information, cannot parse accesstoken`)
 	}
 
+	if azureClient.connectSkipSubscriptionList {
+		azureClient.logger.Info(`skipping Azure Subscription enumeration on connect`)
+		return nil
+	}
+
 	subscriptionList, err := azureClient.ListSubscriptions(ctx)
 	if err != nil {
 		return err
@@ -117,35 +184,135 @@ func (azureClient *ArmClient) Connect() error {
 
 // GetCred returns Azure ARM credential
 func (azureClient *ArmClient) GetCred() azcore.TokenCredential {
-	if azureClient.cred == nil {
-		cred, err := commonAzidentity.NewAzDefaultCredential(azureClient.NewAzCoreClientOptions())
-		if err != nil {
-			panic(err)
-		}
-		azureClient.cred = &cred
+	azureClient.cloudLock.RLock()
+	cred := azureClient.cred
+	azureClient.cloudLock.RUnlock()
+
+	if cred != nil {
+		return *cred
+	}
+
+	azureClient.credLock.Lock()
+	defer azureClient.credLock.Unlock()
+
+	// credential might be created concurrently
+	azureClient.cloudLock.RLock()
+	cred = azureClient.cred
+	azureClient.cloudLock.RUnlock()
+	if cred != nil {
+		return *cred
+	}
+
+	newCred, err := azureClient.newCred()
+	if err != nil {
+		panic(err)
+	}
+	azureClient.setCred(newCred)
+
+	return newCred
+}
+
+// setCred sets Azure ARM credential
+func (azureClient *ArmClient) setCred(cred azcore.TokenCredential) {
+	azureClient.cloudLock.Lock()
+	defer azureClient.cloudLock.Unlock()
+
+	azureClient.cred = &cred
+}
+
+// ReloadCloudConfig replaces the Azure cloud configuration at runtime (eg. after endpoint changes of sovereign clouds),
+// the credential is recreated and the service discovery cache is cleared so following calls use the new endpoints
+//
+//	credentials passed by UseCredentialChain and AddTenantCredential are kept and need to be replaced by the caller,
+//	entries in the shared cache (see SetSharedCache) expire by their ttl
+func (azureClient *ArmClient) ReloadCloudConfig(cloudConfig cloudconfig.CloudEnvironment) {
+	// wait for running credential creation, so no credential of the old cloud is stored afterwards
+	azureClient.credLock.Lock()
+	azureClient.cloudLock.Lock()
+	azureClient.cloud = cloudConfig
+	azureClient.cred = nil
+	azureClient.cloudLock.Unlock()
+	azureClient.credLock.Unlock()
+
+	azureClient.cacheFlush()
+
+	azureClient.logger.Infof(
+		`reloaded Azure Environment "%v" (AzureAD:%s ResourceManager:%s)`,
+		cloudConfig.Name,
+		cloudConfig.ActiveDirectoryAuthorityHost,
+		cloudConfig.Services[cloud.ResourceManager].Endpoint,
+	)
+}
+
+// getCloud returns selected Azure cloud/environment configuration
+func (azureClient *ArmClient) getCloud() cloudconfig.CloudEnvironment {
+	azureClient.cloudLock.RLock()
+	defer azureClient.cloudLock.RUnlock()
+
+	return azureClient.cloud
+}
+
+// RefreshCredential rebuilds Azure ARM credential (eg. after secret rotation) using the selected credential mode
+// and validates it by requesting a token, old credential is kept if the new one is not working
+func (azureClient *ArmClient) RefreshCredential() error {
+	azureClient.credLock.Lock()
+	defer azureClient.credLock.Unlock()
+
+	cred, err := azureClient.newCred()
+	if err != nil {
+		return err
+	}
+
+	_, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{azureClient.tokenScope()}})
+	if err != nil {
+		return fmt.Errorf(`unable to validate refreshed Azure credential: %w`, err)
+	}
+
+	azureClient.setCred(cred)
+	azureClient.logger.Info(`refreshed Azure credential`)
+
+	return nil
+}
+
+// newCred creates new Azure ARM credential based on selected credential mode (credLock needs to be held)
+func (azureClient *ArmClient) newCred() (azcore.TokenCredential, error) {
+	switch azureClient.credMode {
+	case credModeAzCli:
+		return commonAzidentity.NewAzCliCredential()
+	case credModeChain:
+		return azidentity.NewChainedTokenCredential(azureClient.credChain, nil)
+	default:
+		return commonAzidentity.NewAzDefaultCredential(azureClient.NewAzCoreClientOptions())
 	}
+}
 
-	return *azureClient.cred
+// tokenScope returns token scope for Azure ResourceManager
+func (azureClient *ArmClient) tokenScope() string {
+	return strings.TrimSuffix(azureClient.getCloud().Services[cloud.ResourceManager].Endpoint, "/.default") + "/.default"
 }
 
 // GetCloudName returns selected Azure Environment name (eg AzurePublicCloud)
 func (azureClient *ArmClient) GetCloudName() cloudconfig.CloudName {
-	return azureClient.cloud.Name
+	return azureClient.getCloud().Name
 }
 
 // GetCloudConfig returns selected Azure cloud/environment configuration
 func (azureClient *ArmClient) GetCloudConfig() cloud.Configuration {
-	return azureClient.cloud.Configuration
+	return azureClient.getCloud().Configuration
 }
 
 // NewAzCoreClientOptions returns new client options for all arm clients
 func (azureClient *ArmClient) NewAzCoreClientOptions() *azcore.ClientOptions {
 	clientOptions := azcore.ClientOptions{
-		Cloud:            azureClient.cloud.Configuration,
+		Cloud:            azureClient.getCloud().Configuration,
 		PerCallPolicies:  []policy.Policy{},
 		PerRetryPolicies: nil,
 	}
 
+	if transport := azureClient.getTransport(); transport != nil {
+		clientOptions.Transport = transport
+	}
+
 	// azure prometheus tracing
 	if tracing.TracingIsEnabled() {
 		clientOptions.PerRetryPolicies = append(
@@ -161,10 +328,19 @@ func (azureClient *ArmClient) NewAzCoreClientOptions() *azcore.ClientOptions {
 func (azureClient *ArmClient) NewArmClientOptions() *arm.ClientOptions {
 	clientOptions := arm.ClientOptions{
 		ClientOptions: policy.ClientOptions{
-			Cloud: azureClient.cloud.Configuration,
+			Cloud: azureClient.getCloud().Configuration,
+			PerCallPolicies: []policy.Policy{
+				newTokenExpiryPolicy(&azureClient.tokenExpiry),
+				newApiVersionPolicy(&azureClient.apiVersions),
+			},
+			PerRetryPolicies: nil,
 		},
 	}
 
+	if transport := azureClient.getTransport(); transport != nil {
+		clientOptions.Transport = transport
+	}
+
 	// azure prometheus tracing
 	if tracing.TracingIsEnabled() {
 		clientOptions.PerRetryPolicies = append(
@@ -178,11 +354,23 @@ func (azureClient *ArmClient) NewArmClientOptions() *arm.ClientOptions {
 
 // UseAzCliAuth use (force) az cli authentication
 func (azureClient *ArmClient) UseAzCliAuth() {
-	cred, err := commonAzidentity.NewAzCliCredential()
+	azureClient.credLock.Lock()
+	defer azureClient.credLock.Unlock()
+
+	azureClient.credMode = credModeAzCli
+	cred, err := azureClient.newCred()
 	if err != nil {
 		panic(err)
 	}
-	azureClient.cred = &cred
+	azureClient.setCred(cred)
+}
+
+// SetApiVersion overrides api version for all requests of resource type (eg. Microsoft.Network/virtualNetworks)
+//
+//	child resource types needs to be set explicitly (eg. Microsoft.Network/virtualNetworks/subnets),
+//	empty version removes the override
+func (azureClient *ArmClient) SetApiVersion(resourceType, version string) {
+	azureClient.apiVersions.set(resourceType, version)
 }
 
 // SetUserAgent set user agent for all API calls
@@ -190,24 +378,150 @@ func (azureClient *ArmClient) SetUserAgent(useragent string) {
 	azureClient.userAgent = useragent
 }
 
+// SetConnectSkipSubscriptionList set if Connect should skip the subscription enumeration and only validate the token
+func (azureClient *ArmClient) SetConnectSkipSubscriptionList(val bool) {
+	azureClient.connectSkipSubscriptionList = val
+}
+
+// SetTLSConfig set custom TLS configuration (eg. min version, cipher suites) for all API calls
+//
+//	applies to all clients created from NewAzCoreClientOptions and NewArmClientOptions (ARM and azblob, incl. the
+//	azblob cache of prometheus/collector if this client is passed with SetCacheArmClient) and needs to be set before
+//	first API call as the credential keeps its transport once created,
+//	ignored if a custom http client is set (see SetHTTPClient), the TLS configuration needs to be set on its transport then
+func (azureClient *ArmClient) SetTLSConfig(tlsConfig *tls.Config) {
+	azureClient.transportLock.Lock()
+	defer azureClient.transportLock.Unlock()
+	azureClient.tlsConfig = tlsConfig
+	azureClient.transport = nil
+}
+
+// SetHTTPClient set custom http client for all API calls (nil uses the default transport)
+//
+//	takes precedence over SetTLSConfig, SetMaxIdleConns and SetMaxConnsPerHost which are ignored if set,
+//	needs to be set before first API call as the credential keeps its transport once created
+func (azureClient *ArmClient) SetHTTPClient(client *http.Client) {
+	azureClient.transportLock.Lock()
+	defer azureClient.transportLock.Unlock()
+	azureClient.httpClient = client
+	azureClient.transport = nil
+}
+
+// SetMaxIdleConns set maximum idle (keep-alive) connections for all API calls (also used as idle connections per host)
+//
+//	needs to be set before first API call as the credential keeps its transport once created
+func (azureClient *ArmClient) SetMaxIdleConns(val int) {
+	azureClient.transportLock.Lock()
+	defer azureClient.transportLock.Unlock()
+	azureClient.maxIdleConns = val
+	azureClient.transport = nil
+}
+
+// SetMaxConnsPerHost set maximum connections per host for all API calls (0 means no limit)
+//
+//	needs to be set before first API call as the credential keeps its transport once created
+func (azureClient *ArmClient) SetMaxConnsPerHost(val int) {
+	azureClient.transportLock.Lock()
+	defer azureClient.transportLock.Unlock()
+	azureClient.maxConnsPerHost = val
+	azureClient.transport = nil
+}
+
 // SetCacheTtl set TTL for service discovery cache
 func (azureClient *ArmClient) SetCacheTtl(ttl time.Duration) {
 	azureClient.cacheTtl = ttl
 }
 
 // SetSubscriptionFilter set subscription filter, other subscriptions will be ignored
+// (invalidates cached subscription list)
 func (azureClient *ArmClient) SetSubscriptionFilter(subscriptionId ...string) {
 	azureClient.subscriptionFilter = subscriptionId
+	azureClient.cacheDelete(CacheIdentifierSubscriptions)
+}
+
+// SetLocationFilter set location filter (eg. westeurope), resources in other locations will be ignored in resource listings
+// (resource groups, resources, storage accounts, network interfaces, public ips and key vaults)
+//
+//	applies in addition to subscription filter (and tag filters), global resources (location "global") need to be allowed explicitly,
+//	caches contain unfiltered lists and the filter is applied when lists are returned, so it can be changed at any time
+func (azureClient *ArmClient) SetLocationFilter(locations ...string) {
+	azureClient.locationFilter = []string{}
+	for _, location := range locations {
+		azureClient.locationFilter = append(azureClient.locationFilter, normalizeLocation(location))
+	}
 }
 
-func (azureClient *ArmClient) cacheData(identifier string, callback func() (interface{}, error)) (interface{}, error) {
-	if v, ok := azureClient.cache.Get(identifier); ok {
+// SetSubscriptionExcludedStates set subscription states (eg. Deleted, Disabled, Warned, PastDue) which are skipped in subscription listing
+// (invalidates cached subscription list)
+func (azureClient *ArmClient) SetSubscriptionExcludedStates(states ...string) {
+	azureClient.subscriptionExcludedStates = []armsubscriptions.SubscriptionState{}
+	for _, state := range states {
+		azureClient.subscriptionExcludedStates = append(azureClient.subscriptionExcludedStates, armsubscriptions.SubscriptionState(state))
+	}
+	azureClient.cacheDelete(CacheIdentifierSubscriptions)
+}
+
+// getTransport returns custom http client (see SetHTTPClient) or http client (with HTTP/2 enabled) if transport settings are set
+func (azureClient *ArmClient) getTransport() *http.Client {
+	azureClient.transportLock.Lock()
+	defer azureClient.transportLock.Unlock()
+
+	if azureClient.httpClient != nil {
+		return azureClient.httpClient
+	}
+
+	if azureClient.tlsConfig == nil && azureClient.maxIdleConns == 0 && azureClient.maxConnsPerHost == 0 {
+		return nil
+	}
+
+	if azureClient.transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ForceAttemptHTTP2 = true
+
+		if azureClient.tlsConfig != nil {
+			transport.TLSClientConfig = azureClient.tlsConfig.Clone()
+		}
+
+		if azureClient.maxIdleConns > 0 {
+			transport.MaxIdleConns = azureClient.maxIdleConns
+			transport.MaxIdleConnsPerHost = azureClient.maxIdleConns
+		}
+
+		if azureClient.maxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = azureClient.maxConnsPerHost
+		}
+
+		azureClient.transport = &http.Client{Transport: transport}
+	}
+
+	return azureClient.transport
+}
+
+// SetDefaultOperationTimeout sets timeout for fetching data of cached methods (on cache miss) if context has no deadline (0 disables timeout)
+func (azureClient *ArmClient) SetDefaultOperationTimeout(timeout time.Duration) {
+	azureClient.defaultOperationTimeout = timeout
+}
+
+// operationContext returns context with default operation timeout if ctx has no deadline (see SetDefaultOperationTimeout)
+func (azureClient *ArmClient) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline && azureClient.defaultOperationTimeout > 0 {
+		return context.WithTimeout(ctx, azureClient.defaultOperationTimeout)
+	}
+
+	return ctx, func() {}
+}
+
+func (azureClient *ArmClient) cacheData(ctx context.Context, identifier string, callback func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if v, ok := azureClient.cacheGet(identifier); ok {
 		return v, nil
 	}
 
-	result, err := callback()
+	ctx, cancel := azureClient.operationContext(ctx)
+	defer cancel()
+
+	result, err := callback(ctx)
 	if err == nil {
-		azureClient.cache.SetDefault(identifier, result)
+		azureClient.cacheSetDefault(identifier, result)
 	}
 
 	return result, err
@@ -0,0 +1,77 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierKeyVaults = "keyvaults:%s"
+)
+
+// ListCachedKeyVaults return cached list of Azure KeyVaults for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListCachedKeyVaults(ctx context.Context, subscriptionID string) ([]*armkeyvault.Vault, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierKeyVaults, subscriptionID), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure KeyVault list")
+		list, err := azureClient.listKeyVaults(ctx, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure KeyVaults", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, result.([]*armkeyvault.Vault), func(vault *armkeyvault.Vault) *string { return vault.Location }), nil
+}
+
+// ListKeyVaults return list of Azure KeyVaults (incl. sku, soft delete and purge protection settings) for subscription (filtered by location filter)
+//
+//	returns empty list if KeyVault resource provider is not registered for subscription
+func (azureClient *ArmClient) ListKeyVaults(ctx context.Context, subscriptionID string) ([]*armkeyvault.Vault, error) {
+	list, err := azureClient.listKeyVaults(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, list, func(vault *armkeyvault.Vault) *string { return vault.Location }), nil
+}
+
+// listKeyVaults return unfiltered list of Azure KeyVaults for subscription and updates cache
+func (azureClient *ArmClient) listKeyVaults(ctx context.Context, subscriptionID string) ([]*armkeyvault.Vault, error) {
+	list := []*armkeyvault.Vault{}
+
+	client, err := armkeyvault.NewVaultsClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListBySubscriptionPager(nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			if IsMissingSubscriptionRegistration(err) {
+				// subscription has never used KeyVaults
+				azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("KeyVault resource provider is not registered, skipping subscription")
+				break
+			}
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierKeyVaults, subscriptionID), list)
+
+	return list, nil
+}
@@ -0,0 +1,130 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	CacheIdentifierAvailabilityZones = "availabilityzones:%s:%s"
+
+	// availabilityZoneProvider and availabilityZoneResourceType are used for zone lookup (zones are mapped per subscription)
+	availabilityZoneProvider     = "Microsoft.Compute"
+	availabilityZoneResourceType = "virtualMachines"
+)
+
+// ListAvailabilityZones returns cached list of availability zones (eg. 1, 2, 3) of location (eg. westeurope) in subscription,
+// list is empty if location has no availability zones
+//
+//	zones are taken from the zone mappings of the Microsoft.Compute/virtualMachines resource type
+func (azureClient *ArmClient) ListAvailabilityZones(ctx context.Context, subscriptionID, location string) ([]string, error) {
+	location = normalizeLocation(location)
+
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierAvailabilityZones, strings.ToLower(subscriptionID), location), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID), zap.String("location", location)).Debug("updating cached Azure AvailabilityZones list")
+
+		provider, err := azureClient.GetResourceProvider(ctx, subscriptionID, availabilityZoneProvider)
+		if err != nil {
+			return nil, err
+		}
+
+		list := availabilityZonesFromProvider(provider, location)
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID), zap.String("location", location)).Debugf("found %v Azure AvailabilityZones", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// return copy, cached list must not be modified by caller
+	zones := result.([]string)
+	list := make([]string, len(zones))
+	copy(list, zones)
+
+	return list, nil
+}
+
+// availabilityZonesFromProvider returns sorted availability zones of location from the zone mappings of the resource provider
+func availabilityZonesFromProvider(provider *armresources.Provider, location string) []string {
+	list := []string{}
+	if provider == nil {
+		return list
+	}
+
+	location = normalizeLocation(location)
+	for _, resourceType := range provider.ResourceTypes {
+		if resourceType == nil || !strings.EqualFold(to.String(resourceType.ResourceType), availabilityZoneResourceType) {
+			continue
+		}
+
+		for _, zoneMapping := range resourceType.ZoneMappings {
+			if zoneMapping == nil || normalizeLocation(to.String(zoneMapping.Location)) != location {
+				continue
+			}
+
+			for _, zone := range zoneMapping.Zones {
+				if zone != nil {
+					list = append(list, *zone)
+				}
+			}
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// filterListByLocation returns items of list which are allowed by location filter (see SetLocationFilter),
+// list is returned unchanged if no location filter is set
+func filterListByLocation[T any](azureClient *ArmClient, list []T, location func(item T) *string) []T {
+	if len(azureClient.locationFilter) == 0 {
+		return list
+	}
+
+	ret := make([]T, 0, len(list))
+	for _, item := range list {
+		if azureClient.isLocationAllowed(location(item)) {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// filterMapByLocation returns copy of map with items which are allowed by location filter (see SetLocationFilter)
+func filterMapByLocation[K comparable, T any](azureClient *ArmClient, list map[K]T, location func(item T) *string) map[K]T {
+	ret := make(map[K]T, len(list))
+	for key, item := range list {
+		if azureClient.isLocationAllowed(location(item)) {
+			ret[key] = item
+		}
+	}
+	return ret
+}
+
+// isLocationAllowed returns true if location matches location filter (see SetLocationFilter)
+func (azureClient *ArmClient) isLocationAllowed(location *string) bool {
+	if len(azureClient.locationFilter) == 0 {
+		return true
+	}
+
+	name := normalizeLocation(to.String(location))
+	for _, allowedLocation := range azureClient.locationFilter {
+		if name == allowedLocation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeLocation converts location display name (eg. West Europe) to location name (eg. westeurope)
+func normalizeLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
@@ -0,0 +1,218 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+func Test_LocationFilter(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	azureClient := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	if !azureClient.isLocationAllowed(to.StringPtr("eastus")) {
+		t.Fatalf(`expected all locations to be allowed without location filter`)
+	}
+
+	azureClient.SetLocationFilter("West Europe", "germanywestcentral")
+
+	locations := map[string]bool{
+		"westeurope":           true,
+		"WestEurope":           true,
+		"Germany West Central": true,
+		"eastus":               false,
+		"global":               false,
+		"":                     false,
+	}
+
+	for location, expected := range locations {
+		if allowed := azureClient.isLocationAllowed(to.StringPtr(location)); allowed != expected {
+			t.Fatalf(`expected location "%v" allowed=%v, got %v`, location, expected, allowed)
+		}
+	}
+
+	if azureClient.isLocationAllowed(nil) {
+		t.Fatalf(`expected resource without location not to be allowed`)
+	}
+}
+
+func Test_LocationFilterCachedLists(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	subscriptionID := "00000000-0000-0000-0000-000000000000"
+
+	azureClient := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	azureClient.cacheSetDefault(
+		fmt.Sprintf(CacheIdentifierResourceGroupList, subscriptionID),
+		map[string]*armresources.ResourceGroup{
+			"rg-weu":  {Location: to.StringPtr("westeurope"), Tags: map[string]*string{"team": to.StringPtr("foo")}},
+			"rg-weu2": {Location: to.StringPtr("westeurope"), Tags: map[string]*string{"team": to.StringPtr("bar")}},
+			"rg-eus":  {Location: to.StringPtr("eastus"), Tags: map[string]*string{"team": to.StringPtr("foo")}},
+		},
+	)
+	resourceID := "/subscriptions/" + subscriptionID + "/resourcegroups/rg-eus/providers/microsoft.storage/storageaccounts/foo"
+	azureClient.cacheSetDefault(
+		fmt.Sprintf(CacheIdentifierResourcesList, subscriptionID),
+		map[string]*armresources.GenericResourceExpanded{
+			resourceID: {ID: to.StringPtr(resourceID), Location: to.StringPtr("eastus")},
+		},
+	)
+
+	azureClient.SetLocationFilter("westeurope")
+
+	resourceGroups, err := azureClient.ListCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resourceGroups) != 2 || resourceGroups["rg-eus"] != nil {
+		t.Fatalf(`expected only resource groups in westeurope, got %v`, resourceGroups)
+	}
+
+	// tag and location filter are combined
+	resourceGroups, err = azureClient.ListCachedResourceGroupsByTag(ctx, subscriptionID, "Team", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resourceGroups) != 1 || resourceGroups["rg-weu"] == nil {
+		t.Fatalf(`expected only resource group rg-weu, got %v`, resourceGroups)
+	}
+
+	// resource group tags are filtered by location
+	resourceGroupsTags, err := azureClient.GetResourceGroupsTags(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resourceGroupsTags) != 2 || resourceGroupsTags["rg-eus"] != nil {
+		t.Fatalf(`expected only tags of resource groups in westeurope, got %v`, resourceGroupsTags)
+	}
+
+	if _, err := azureClient.GetResourceGroupTags(ctx, subscriptionID, "rg-eus"); err == nil {
+		t.Fatalf(`expected resource group rg-eus not to be found`)
+	}
+	if tags, err := azureClient.GetResourceGroupTags(ctx, subscriptionID, "RG-WEU"); err != nil || tags["team"] != "foo" {
+		t.Fatalf(`expected tags of resource group rg-weu, got %v (%v)`, tags, err)
+	}
+
+	resources, err := azureClient.ListCachedResources(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 0 {
+		t.Fatalf(`expected no resources in westeurope, got %v`, resources)
+	}
+
+	resource, err := azureClient.GetCachedResource(ctx, resourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource != nil {
+		t.Fatalf(`expected resource in eastus to be filtered`)
+	}
+
+	// changed filter applies to already cached lists
+	azureClient.SetLocationFilter("eastus")
+
+	resourceGroups, err = azureClient.ListCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resourceGroups) != 1 || resourceGroups["rg-eus"] == nil {
+		t.Fatalf(`expected only resource group rg-eus, got %v`, resourceGroups)
+	}
+
+	resource, err = azureClient.GetCachedResource(ctx, resourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource == nil {
+		t.Fatalf(`expected resource in eastus to be returned`)
+	}
+
+	// without filter all cached entries are returned
+	azureClient.SetLocationFilter()
+
+	resourceGroups, err = azureClient.ListCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resourceGroups) != 3 {
+		t.Fatalf(`expected 3 resource groups without location filter, got %v`, len(resourceGroups))
+	}
+}
+
+func Test_NormalizeLocation(t *testing.T) {
+	locations := map[string]string{
+		"westeurope":           "westeurope",
+		"West Europe":          "westeurope",
+		"WestEurope":           "westeurope",
+		"Germany West Central": "germanywestcentral",
+		"global":               "global",
+		"":                     "",
+	}
+
+	for location, expected := range locations {
+		if normalized := normalizeLocation(location); normalized != expected {
+			t.Fatalf(`expected location "%v" to be normalized to "%v", got "%v"`, location, expected, normalized)
+		}
+	}
+}
+
+func Test_AvailabilityZonesFromProvider(t *testing.T) {
+	provider := &armresources.Provider{
+		ResourceTypes: []*armresources.ProviderResourceType{
+			{
+				ResourceType: to.StringPtr("disks"),
+				ZoneMappings: []*armresources.ZoneMapping{
+					{Location: to.StringPtr("West Europe"), Zones: []*string{to.StringPtr("4")}},
+				},
+			},
+			nil,
+			{
+				ResourceType: to.StringPtr("virtualMachines"),
+				ZoneMappings: []*armresources.ZoneMapping{
+					{Location: to.StringPtr("West Europe"), Zones: []*string{to.StringPtr("3"), to.StringPtr("1"), nil, to.StringPtr("2")}},
+					{Location: to.StringPtr("Germany West Central"), Zones: []*string{to.StringPtr("1")}},
+					{Location: to.StringPtr("North Europe"), Zones: []*string{}},
+					nil,
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		provider *armresources.Provider
+		location string
+		expected []string
+	}{
+		{name: "location name", provider: provider, location: "westeurope", expected: []string{"1", "2", "3"}},
+		{name: "location display name", provider: provider, location: "West Europe", expected: []string{"1", "2", "3"}},
+		{name: "single zone", provider: provider, location: "germanywestcentral", expected: []string{"1"}},
+		{name: "location without zones", provider: provider, location: "northeurope", expected: []string{}},
+		{name: "unknown location", provider: provider, location: "eastus", expected: []string{}},
+		{name: "without provider", provider: nil, location: "westeurope", expected: []string{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			zones := availabilityZonesFromProvider(testCase.provider, testCase.location)
+			if zones == nil || strings.Join(zones, ",") != strings.Join(testCase.expected, ",") {
+				t.Fatalf(`expected zones %v, got %v`, testCase.expected, zones)
+			}
+		})
+	}
+}
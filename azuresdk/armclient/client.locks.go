@@ -0,0 +1,66 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armlocks"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierResourceLocks = "locks:%s"
+)
+
+// ListCachedResourceLocks return cached list of Azure management locks for scope (subscription, resourcegroup or resource)
+func (azureClient *ArmClient) ListCachedResourceLocks(ctx context.Context, scope string) ([]*armlocks.ManagementLockObject, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierResourceLocks, strings.ToLower(scope)), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("scope", scope)).Debug("updating cached Azure ResourceLock list")
+		list, err := azureClient.ListResourceLocks(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("scope", scope)).Debugf("found %v Azure ResourceLocks", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*armlocks.ManagementLockObject), nil
+}
+
+// ListResourceLocks return list of Azure management locks (incl. level and notes) for scope (subscription, resourcegroup or resource)
+func (azureClient *ArmClient) ListResourceLocks(ctx context.Context, scope string) ([]*armlocks.ManagementLockObject, error) {
+	list := []*armlocks.ManagementLockObject{}
+
+	scopeInfo, err := ParseResourceId(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := armlocks.NewManagementLocksClient(scopeInfo.Subscription, azureClient.GetCredForSubscription(scopeInfo.Subscription), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListByScopePager(scope, nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierResourceLocks, strings.ToLower(scope)), list)
+
+	return list, nil
+}
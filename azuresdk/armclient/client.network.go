@@ -0,0 +1,128 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierNetworkInterfaces = "networkinterfaces:%s"
+	CacheIdentifierPublicIPAddresses = "publicipaddresses:%s"
+)
+
+// ListCachedNetworkInterfaces return cached list of Azure NetworkInterfaces for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListCachedNetworkInterfaces(ctx context.Context, subscriptionID string) ([]*armnetwork.Interface, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierNetworkInterfaces, subscriptionID), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure NetworkInterface list")
+		list, err := azureClient.listNetworkInterfaces(ctx, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure NetworkInterfaces", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, result.([]*armnetwork.Interface), func(networkInterface *armnetwork.Interface) *string { return networkInterface.Location }), nil
+}
+
+// ListNetworkInterfaces return list of Azure NetworkInterfaces (incl. ip configurations) for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListNetworkInterfaces(ctx context.Context, subscriptionID string) ([]*armnetwork.Interface, error) {
+	list, err := azureClient.listNetworkInterfaces(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, list, func(networkInterface *armnetwork.Interface) *string { return networkInterface.Location }), nil
+}
+
+// listNetworkInterfaces return unfiltered list of Azure NetworkInterfaces for subscription and updates cache
+func (azureClient *ArmClient) listNetworkInterfaces(ctx context.Context, subscriptionID string) ([]*armnetwork.Interface, error) {
+	list := []*armnetwork.Interface{}
+
+	client, err := armnetwork.NewInterfacesClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListAllPager(nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierNetworkInterfaces, subscriptionID), list)
+
+	return list, nil
+}
+
+// ListCachedPublicIPAddresses return cached list of Azure PublicIPAddresses for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListCachedPublicIPAddresses(ctx context.Context, subscriptionID string) ([]*armnetwork.PublicIPAddress, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierPublicIPAddresses, subscriptionID), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure PublicIPAddress list")
+		list, err := azureClient.listPublicIPAddresses(ctx, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure PublicIPAddresses", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, result.([]*armnetwork.PublicIPAddress), func(publicIPAddress *armnetwork.PublicIPAddress) *string { return publicIPAddress.Location }), nil
+}
+
+// ListPublicIPAddresses return list of Azure PublicIPAddresses for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListPublicIPAddresses(ctx context.Context, subscriptionID string) ([]*armnetwork.PublicIPAddress, error) {
+	list, err := azureClient.listPublicIPAddresses(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, list, func(publicIPAddress *armnetwork.PublicIPAddress) *string { return publicIPAddress.Location }), nil
+}
+
+// listPublicIPAddresses return unfiltered list of Azure PublicIPAddresses for subscription and updates cache
+func (azureClient *ArmClient) listPublicIPAddresses(ctx context.Context, subscriptionID string) ([]*armnetwork.PublicIPAddress, error) {
+	list := []*armnetwork.PublicIPAddress{}
+
+	client, err := armnetwork.NewPublicIPAddressesClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListAllPager(nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierPublicIPAddresses, subscriptionID), list)
+
+	return list, nil
+}
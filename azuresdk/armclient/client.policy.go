@@ -0,0 +1,126 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierPolicyAssignments = "policyassignments:%s"
+)
+
+var (
+	managementGroupScopeRegExp = regexp.MustCompile(`(?i)^/providers/Microsoft\.Management/managementGroups/([^/]+)/?$`)
+)
+
+// ListCachedPolicyAssignments return cached list of Azure Policy assignments for scope (subscription or management group)
+func (azureClient *ArmClient) ListCachedPolicyAssignments(ctx context.Context, scope string) ([]*armpolicy.Assignment, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierPolicyAssignments, strings.ToLower(scope)), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("scope", scope)).Debug("updating cached Azure PolicyAssignment list")
+		list, err := azureClient.ListPolicyAssignments(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("scope", scope)).Debugf("found %v Azure PolicyAssignments", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*armpolicy.Assignment), nil
+}
+
+// ListPolicyAssignments return list of Azure Policy assignments (incl. policy definition id and parameters) for scope
+//
+//	scope can be a subscription (/subscriptions/xxx) or a management group (/providers/Microsoft.Management/managementGroups/xxx),
+//	management groups are listed with the default credential first and then with the credentials of additional tenants
+//	(see AddTenantCredential) as the tenant of the management group is not known
+func (azureClient *ArmClient) ListPolicyAssignments(ctx context.Context, scope string) ([]*armpolicy.Assignment, error) {
+	list := []*armpolicy.Assignment{}
+
+	// management group scope
+	if match := managementGroupScopeRegExp.FindStringSubmatch(scope); match != nil {
+		var firstErr error
+		for _, cred := range azureClient.listCredentials() {
+			result, err := azureClient.listManagementGroupPolicyAssignments(ctx, match[1], cred)
+			if err == nil {
+				list, firstErr = result, nil
+				break
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	} else {
+		// subscription scope
+		scopeInfo, err := ParseResourceId(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		if scopeInfo.ResourceGroup != "" {
+			return nil, fmt.Errorf(`scope "%v" is not supported, only subscription and management group scopes are supported`, scope)
+		}
+
+		client, err := armpolicy.NewAssignmentsClient(scopeInfo.Subscription, azureClient.GetCredForSubscription(scopeInfo.Subscription), azureClient.NewArmClientOptions())
+		if err != nil {
+			return nil, err
+		}
+
+		pager := client.NewListPager(nil)
+		for pager.More() {
+			result, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if result.Value == nil {
+				continue
+			}
+
+			list = append(list, result.Value...)
+		}
+	}
+
+	// update cache
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierPolicyAssignments, strings.ToLower(scope)), list)
+
+	return list, nil
+}
+
+// listManagementGroupPolicyAssignments returns list of Azure Policy assignments of management group using credential
+func (azureClient *ArmClient) listManagementGroupPolicyAssignments(ctx context.Context, managementGroupID string, cred azcore.TokenCredential) ([]*armpolicy.Assignment, error) {
+	client, err := armpolicy.NewAssignmentsClient("", cred, azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*armpolicy.Assignment{}
+	pager := client.NewListForManagementGroupPager(managementGroupID, nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	return list, nil
+}
@@ -3,8 +3,10 @@ package armclient
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/webdevops/go-common/utils/to"
@@ -15,17 +17,43 @@ const (
 	CacheIdentifierResourceGroup     = "resourcegroups:%s:%s"
 )
 
-// ListCachedResourceGroups return cached list of Azure ResourceGroups as map (key is name of ResourceGroup)
+// ListCachedResourceGroups return cached list of Azure ResourceGroups as map (key is name of ResourceGroup, filtered by location filter)
+//
+//	returns a copy of the cached list, so the list can be modified by the caller,
+//	the ResourceGroups are shared with the cache and must not be modified
 func (azureClient *ArmClient) ListCachedResourceGroups(ctx context.Context, subscriptionID string) (map[string]*armresources.ResourceGroup, error) {
-	result, err := azureClient.cacheData(fmt.Sprintf(CacheIdentifierResourceGroupList, subscriptionID), func() (interface{}, error) {
+	list, err := azureClient.listCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterMapByLocation(azureClient, list, func(resourceGroup *armresources.ResourceGroup) *string { return resourceGroup.Location }), nil
+}
+
+// listCachedResourceGroups return cached unfiltered list of Azure ResourceGroups as map (key is name of ResourceGroup), list is shared and must not be modified
+func (azureClient *ArmClient) listCachedResourceGroups(ctx context.Context, subscriptionID string) (map[string]*armresources.ResourceGroup, error) {
+	ctx, span := azureClient.startSpan(ctx, "ListCachedResourceGroups", attribute.String("azure.subscription_id", subscriptionID))
+	cacheKey := fmt.Sprintf(CacheIdentifierResourceGroupList, subscriptionID)
+	cacheHit := true
+	result, err := azureClient.cacheData(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		cacheHit = false
+		list := map[string]*armresources.ResourceGroup{}
+		if azureClient.sharedCacheGet(cacheKey, &list) {
+			azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("using %v Azure ResourceGroups from shared cache", len(list))
+			return list, nil
+		}
+
 		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure ResourceGroup list")
-		list, err := azureClient.ListResourceGroups(ctx, subscriptionID)
+		list, err := azureClient.listResourceGroups(ctx, subscriptionID)
 		if err != nil {
 			return list, err
 		}
 		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure ResourceGroups", len(list))
+		azureClient.sharedCacheSet(cacheKey, list)
 		return list, nil
 	})
+	span.SetAttributes(attribute.Bool("cache.hit", cacheHit))
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -33,11 +61,82 @@ func (azureClient *ArmClient) ListCachedResourceGroups(ctx context.Context, subs
 	return result.(map[string]*armresources.ResourceGroup), nil
 }
 
-// ListResourceGroups return list of Azure ResourceGroups as map (key is name of ResourceGroup)
+// ListCachedResourceGroupsByTag return cached list of Azure ResourceGroups filtered by tag (tag name is case-insensitive)
+// and location filter as map (key is name of ResourceGroup)
+func (azureClient *ArmClient) ListCachedResourceGroupsByTag(ctx context.Context, subscriptionID, tagKey, tagValue string) (map[string]*armresources.ResourceGroup, error) {
+	list, err := azureClient.ListCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*armresources.ResourceGroup{}
+	for resourceGroupName, resourceGroup := range list {
+		for name, value := range resourceGroup.Tags {
+			if strings.EqualFold(name, tagKey) && to.String(value) == tagValue {
+				ret[resourceGroupName] = resourceGroup
+				break
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// GetResourceGroupTags return tags of Azure ResourceGroup (using cached ResourceGroup list, ResourceGroups not allowed by location filter are not found)
+func (azureClient *ArmClient) GetResourceGroupTags(ctx context.Context, subscriptionID, resourceGroupName string) (map[string]string, error) {
+	list, err := azureClient.listCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceGroupName = strings.ToLower(resourceGroupName)
+	if resourceGroup, exists := list[resourceGroupName]; exists && azureClient.isLocationAllowed(resourceGroup.Location) {
+		return to.StringMap(resourceGroup.Tags), nil
+	}
+
+	return nil, fmt.Errorf(`resourceGroup "%v" not found`, resourceGroupName)
+}
+
+// GetResourceGroupsTags return tags of all Azure ResourceGroups in subscription (using cached ResourceGroup list, filtered by location filter)
+// as map (key is name of ResourceGroup, tag names are lowercased as Azure tag names are case-insensitive)
+func (azureClient *ArmClient) GetResourceGroupsTags(ctx context.Context, subscriptionID string) (map[string]map[string]string, error) {
+	list, err := azureClient.ListCachedResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]map[string]string, len(list))
+	for resourceGroupName, resourceGroup := range list {
+		tags := make(map[string]string, len(resourceGroup.Tags))
+		for name, value := range resourceGroup.Tags {
+			tags[strings.ToLower(name)] = to.String(value)
+		}
+		ret[strings.ToLower(resourceGroupName)] = tags
+	}
+
+	return ret, nil
+}
+
+// ListResourceGroups return list of Azure ResourceGroups as map (key is name of ResourceGroup, filtered by location filter)
 func (azureClient *ArmClient) ListResourceGroups(ctx context.Context, subscriptionID string) (map[string]*armresources.ResourceGroup, error) {
-	list := map[string]*armresources.ResourceGroup{}
+	list, err := azureClient.listResourceGroups(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterMapByLocation(azureClient, list, func(resourceGroup *armresources.ResourceGroup) *string { return resourceGroup.Location }), nil
+}
+
+// listResourceGroups return unfiltered list of Azure ResourceGroups as map (key is name of ResourceGroup) and updates cache
+func (azureClient *ArmClient) listResourceGroups(ctx context.Context, subscriptionID string) (list map[string]*armresources.ResourceGroup, err error) {
+	ctx, span := azureClient.startSpan(ctx, "ListResourceGroups", attribute.String("azure.subscription_id", subscriptionID))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	list = map[string]*armresources.ResourceGroup{}
 
-	client, err := armresources.NewResourceGroupsClient(subscriptionID, azureClient.GetCred(), azureClient.NewArmClientOptions())
+	client, err := armresources.NewResourceGroupsClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -58,8 +157,8 @@ func (azureClient *ArmClient) ListResourceGroups(ctx context.Context, subscripti
 		}
 	}
 
-	// update cache
-	azureClient.cache.SetDefault(fmt.Sprintf(CacheIdentifierResourceGroupList, subscriptionID), list)
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierResourceGroupList, subscriptionID), list)
 
 	return list, nil
 }
@@ -0,0 +1,103 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcehealth/armresourcehealth"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierResourceHealthList = "resourcehealth:%s"
+	CacheIdentifierResourceHealth     = "resourcehealth:resource:%s"
+
+	// resource health changes frequently
+	resourceHealthCacheTtl = 5 * time.Minute
+)
+
+// GetCachedResourceHealth return cached Azure ResourceHealth (availability state and reason) for resource
+func (azureClient *ArmClient) GetCachedResourceHealth(ctx context.Context, resourceID string) (*armresourcehealth.AvailabilityStatus, error) {
+	cacheKey := fmt.Sprintf(CacheIdentifierResourceHealth, strings.ToLower(resourceID))
+	if v, ok := azureClient.cacheGet(cacheKey); ok {
+		return v.(*armresourcehealth.AvailabilityStatus), nil
+	}
+
+	ctx, cancel := azureClient.operationContext(ctx)
+	defer cancel()
+
+	return azureClient.GetResourceHealth(ctx, resourceID)
+}
+
+// GetResourceHealth return Azure ResourceHealth (availability state and reason) for resource
+func (azureClient *ArmClient) GetResourceHealth(ctx context.Context, resourceID string) (*armresourcehealth.AvailabilityStatus, error) {
+	resourceInfo, err := ParseResourceId(resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := armresourcehealth.NewAvailabilityStatusesClient(resourceInfo.Subscription, azureClient.GetCredForSubscription(resourceInfo.Subscription), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetByResource(ctx, resourceID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// update cache
+	azureClient.cacheSet(fmt.Sprintf(CacheIdentifierResourceHealth, strings.ToLower(resourceID)), &result.AvailabilityStatus, resourceHealthCacheTtl)
+
+	return &result.AvailabilityStatus, nil
+}
+
+// ListCachedResourceHealth return cached list of Azure ResourceHealth (availability state and reason) of all resources in subscription
+func (azureClient *ArmClient) ListCachedResourceHealth(ctx context.Context, subscriptionID string) ([]*armresourcehealth.AvailabilityStatus, error) {
+	if v, ok := azureClient.cacheGet(fmt.Sprintf(CacheIdentifierResourceHealthList, subscriptionID)); ok {
+		return v.([]*armresourcehealth.AvailabilityStatus), nil
+	}
+
+	ctx, cancel := azureClient.operationContext(ctx)
+	defer cancel()
+
+	azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure ResourceHealth list")
+	list, err := azureClient.ListResourceHealth(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure ResourceHealth states", len(list))
+
+	return list, nil
+}
+
+// ListResourceHealth return list of Azure ResourceHealth (availability state and reason) of all resources in subscription
+func (azureClient *ArmClient) ListResourceHealth(ctx context.Context, subscriptionID string) ([]*armresourcehealth.AvailabilityStatus, error) {
+	list := []*armresourcehealth.AvailabilityStatus{}
+
+	client, err := armresourcehealth.NewAvailabilityStatusesClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListBySubscriptionIDPager(nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache
+	azureClient.cacheSet(fmt.Sprintf(CacheIdentifierResourceHealthList, subscriptionID), list, resourceHealthCacheTtl)
+
+	return list, nil
+}
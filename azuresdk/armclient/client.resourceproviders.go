@@ -47,9 +47,14 @@ func (azureClient *ArmClient) IsResourceProviderRegistered(ctx context.Context,
 	return false, nil
 }
 
+// IsProviderRegistered alias of IsResourceProviderRegistered
+func (azureClient *ArmClient) IsProviderRegistered(ctx context.Context, subscriptionID, namespace string) (bool, error) {
+	return azureClient.IsResourceProviderRegistered(ctx, subscriptionID, namespace)
+}
+
 // ListCachedResourceProviders return cached list of Azure Resource Providers as map (key is namespace)
 func (azureClient *ArmClient) ListCachedResourceProviders(ctx context.Context, subscriptionID string) (map[string]*armresources.Provider, error) {
-	result, err := azureClient.cacheData(fmt.Sprintf(CacheIdentifierResourceProviders, subscriptionID), func() (interface{}, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierResourceProviders, subscriptionID), func(ctx context.Context) (interface{}, error) {
 		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure ResourceProviders list")
 		list, err := azureClient.ListResourceProviders(ctx, subscriptionID)
 		if err != nil {
@@ -69,7 +74,7 @@ func (azureClient *ArmClient) ListCachedResourceProviders(ctx context.Context, s
 func (azureClient *ArmClient) ListResourceProviders(ctx context.Context, subscriptionID string) (map[string]*armresources.Provider, error) {
 	list := map[string]*armresources.Provider{}
 
-	client, err := armresources.NewProvidersClient(subscriptionID, azureClient.GetCred(), azureClient.NewArmClientOptions())
+	client, err := armresources.NewProvidersClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +96,7 @@ func (azureClient *ArmClient) ListResourceProviders(ctx context.Context, subscri
 	}
 
 	// update cache
-	azureClient.cache.SetDefault(fmt.Sprintf(CacheIdentifierResourceProviders, subscriptionID), list)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierResourceProviders, subscriptionID), list)
 
 	return list, nil
 }
@@ -16,10 +16,10 @@ const (
 	CacheIdentifierResourcesID   = "resourceID:%s"
 )
 
-// GetCachedResource return cached Azure Resource by resourceID
+// GetCachedResource return cached Azure Resource by resourceID, returns nil if resource is not allowed by location filter
 func (azureClient *ArmClient) GetCachedResource(ctx context.Context, resourceID string) (*armresources.GenericResourceExpanded, error) {
 	cacheKey := fmt.Sprintf(CacheIdentifierResourcesID, strings.ToLower(resourceID))
-	result, err := azureClient.cacheData(cacheKey, func() (interface{}, error) {
+	result, err := azureClient.cacheData(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
 		var resource *armresources.GenericResourceExpanded
 
 		resourceInfo, err := ParseResourceId(resourceID)
@@ -27,7 +27,7 @@ func (azureClient *ArmClient) GetCachedResource(ctx context.Context, resourceID
 			return nil, err
 		}
 
-		list, err := azureClient.ListCachedResources(ctx, resourceInfo.Subscription)
+		list, err := azureClient.listCachedResources(ctx, resourceInfo.Subscription)
 		if err != nil {
 			return list, err
 		}
@@ -43,14 +43,29 @@ func (azureClient *ArmClient) GetCachedResource(ctx context.Context, resourceID
 		return nil, err
 	}
 
-	return result.(*armresources.GenericResourceExpanded), nil
+	resource := result.(*armresources.GenericResourceExpanded)
+	if resource != nil && !azureClient.isLocationAllowed(resource.Location) {
+		return nil, nil
+	}
+
+	return resource, nil
 }
 
-// ListCachedResources return cached list of Azure Resources as map (key is ResourceID)
+// ListCachedResources return cached list of Azure Resources as map (key is ResourceID, filtered by location filter)
 func (azureClient *ArmClient) ListCachedResources(ctx context.Context, subscriptionID string) (map[string]*armresources.GenericResourceExpanded, error) {
-	result, err := azureClient.cacheData(fmt.Sprintf(CacheIdentifierResourcesList, subscriptionID), func() (interface{}, error) {
+	list, err := azureClient.listCachedResources(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterMapByLocation(azureClient, list, func(resource *armresources.GenericResourceExpanded) *string { return resource.Location }), nil
+}
+
+// listCachedResources return cached unfiltered list of Azure Resources as map (key is ResourceID), list is shared and must not be modified
+func (azureClient *ArmClient) listCachedResources(ctx context.Context, subscriptionID string) (map[string]*armresources.GenericResourceExpanded, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierResourcesList, subscriptionID), func(ctx context.Context) (interface{}, error) {
 		azureClient.logger.With(zap.String(`subscriptionID`, subscriptionID)).Debug("updating cached Azure Resource list")
-		list, err := azureClient.ListResources(ctx, subscriptionID)
+		list, err := azureClient.listResources(ctx, subscriptionID)
 		if err != nil {
 			return list, err
 		}
@@ -64,11 +79,21 @@ func (azureClient *ArmClient) ListCachedResources(ctx context.Context, subscript
 	return result.(map[string]*armresources.GenericResourceExpanded), nil
 }
 
-// ListResources return list of Azure Resources as map (key is ResourceID)
+// ListResources return list of Azure Resources as map (key is ResourceID, filtered by location filter)
 func (azureClient *ArmClient) ListResources(ctx context.Context, subscriptionID string) (map[string]*armresources.GenericResourceExpanded, error) {
+	list, err := azureClient.listResources(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterMapByLocation(azureClient, list, func(resource *armresources.GenericResourceExpanded) *string { return resource.Location }), nil
+}
+
+// listResources return unfiltered list of Azure Resources as map (key is ResourceID) and updates cache
+func (azureClient *ArmClient) listResources(ctx context.Context, subscriptionID string) (map[string]*armresources.GenericResourceExpanded, error) {
 	list := map[string]*armresources.GenericResourceExpanded{}
 
-	client, err := armresources.NewClient(subscriptionID, azureClient.GetCred(), azureClient.NewArmClientOptions())
+	client, err := armresources.NewClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -89,11 +114,11 @@ func (azureClient *ArmClient) ListResources(ctx context.Context, subscriptionID
 		}
 	}
 
-	// update cache
-	azureClient.cache.SetDefault(fmt.Sprintf(CacheIdentifierResourcesList, subscriptionID), list)
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierResourcesList, subscriptionID), list)
 
 	for resourceID, resource := range list {
-		azureClient.cache.SetDefault(fmt.Sprintf(CacheIdentifierResourcesID, resourceID), resource)
+		azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierResourcesID, resourceID), resource)
 	}
 
 	return list, nil
@@ -0,0 +1,107 @@
+package armclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	commonAzidentity "github.com/webdevops/go-common/azuresdk/azidentity"
+)
+
+const (
+	// sharedCacheNamespace is the prefix of all shared cache keys
+	sharedCacheNamespace = "armclient"
+)
+
+type (
+	// SharedCache is a cache shared between multiple replicas (eg. Redis) for service discovery results
+	// values are JSON encoded
+	SharedCache interface {
+		Get(key string) ([]byte, bool)
+		Set(key string, value []byte, ttl time.Duration)
+	}
+)
+
+// SetSharedCache set shared cache for service discovery results (subscriptions, resourcegroups),
+// the in-memory cache is still used as first level cache
+//
+//	keys contain a fingerprint of cloud, tenants and filters, so only clients with the same settings share entries
+func (azureClient *ArmClient) SetSharedCache(sharedCache SharedCache) {
+	azureClient.sharedCache = sharedCache
+}
+
+// sharedCacheKey returns shared cache key (namespace, settings fingerprint and identifier) for identifier
+func (azureClient *ArmClient) sharedCacheKey(identifier string) string {
+	tenants := []string{os.Getenv(commonAzidentity.EnvAzureTenantID)}
+	for tenantID := range azureClient.listTenantCredentials() {
+		tenants = append(tenants, tenantID)
+	}
+
+	excludedStates := []string{}
+	for _, state := range azureClient.subscriptionExcludedStates {
+		excludedStates = append(excludedStates, string(state))
+	}
+
+	// settings which influence the cached results (location filter is applied after cache lookup)
+	settings := map[string][]string{
+		"cloud":          {string(azureClient.GetCloudName())},
+		"tenants":        tenants,
+		"subscriptions":  azureClient.subscriptionFilter,
+		"excludedStates": excludedStates,
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		values := make([]string, 0, len(settings[name]))
+		for _, value := range settings[name] {
+			values = append(values, strings.ToLower(value))
+		}
+		sort.Strings(values)
+		fmt.Fprintf(hash, "%s=%s\n", name, strings.Join(values, ","))
+	}
+
+	return fmt.Sprintf(`%s:%s:%s`, sharedCacheNamespace, hex.EncodeToString(hash.Sum(nil))[:16], identifier)
+}
+
+// sharedCacheGet fetches value from shared cache (if set) and decodes into target, returns true on success
+func (azureClient *ArmClient) sharedCacheGet(identifier string, target interface{}) bool {
+	if azureClient.sharedCache == nil {
+		return false
+	}
+
+	if content, exists := azureClient.sharedCache.Get(azureClient.sharedCacheKey(identifier)); exists {
+		if err := json.Unmarshal(content, target); err == nil {
+			return true
+		} else {
+			azureClient.logger.Warnf(`unable to decode shared cache entry "%v": %v`, identifier, err.Error())
+		}
+	}
+
+	return false
+}
+
+// sharedCacheSet stores value in shared cache (if set)
+func (azureClient *ArmClient) sharedCacheSet(identifier string, value interface{}) {
+	if azureClient.sharedCache == nil {
+		return
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		azureClient.logger.Warnf(`unable to encode shared cache entry "%v": %v`, identifier, err.Error())
+		return
+	}
+
+	azureClient.sharedCache.Set(azureClient.sharedCacheKey(identifier), content, azureClient.cacheTtl)
+}
@@ -0,0 +1,121 @@
+package armclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+type testSharedCache struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+}
+
+func (cache *testSharedCache) Get(key string) ([]byte, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	content, exists := cache.entries[key]
+	return content, exists
+}
+
+func (cache *testSharedCache) Set(key string, value []byte, ttl time.Duration) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = value
+}
+
+func Test_SharedCacheKey(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	key := client.sharedCacheKey(CacheIdentifierSubscriptions)
+	if !strings.HasPrefix(key, sharedCacheNamespace+":") || !strings.HasSuffix(key, ":"+CacheIdentifierSubscriptions) {
+		t.Fatalf(`expected namespaced shared cache key, got "%v"`, key)
+	}
+
+	// order and case of filters do not change the key
+	client.SetSubscriptionFilter("D7B0CF13-DDF7-43EA-81F1-6F659767A318", "6e3ea4e1-a7ee-4c6d-b1b4-5d2a2c3b8f6e")
+	filteredKey := client.sharedCacheKey(CacheIdentifierSubscriptions)
+	client.SetSubscriptionFilter("6e3ea4e1-a7ee-4c6d-b1b4-5d2a2c3b8f6e", "d7b0cf13-ddf7-43ea-81f1-6f659767a318")
+	if sameKey := client.sharedCacheKey(CacheIdentifierSubscriptions); sameKey != filteredKey {
+		t.Fatalf(`expected same shared cache key for same filter, got "%v" and "%v"`, filteredKey, sameKey)
+	}
+
+	keys := map[string]string{
+		"default":            key,
+		"subscriptionFilter": filteredKey,
+	}
+
+	client.SetSubscriptionExcludedStates("Disabled")
+	keys["excludedStates"] = client.sharedCacheKey(CacheIdentifierSubscriptions)
+
+	// location filter is applied after cache lookup and does not change the key
+	locationKey := client.sharedCacheKey(CacheIdentifierSubscriptions)
+	client.SetLocationFilter("westeurope")
+	if sameKey := client.sharedCacheKey(CacheIdentifierSubscriptions); sameKey != locationKey {
+		t.Fatalf(`expected same shared cache key with location filter, got "%v" and "%v"`, locationKey, sameKey)
+	}
+
+	client.AddTenantCredential("b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90", &testTokenCredential{})
+	keys["tenant"] = client.sharedCacheKey(CacheIdentifierSubscriptions)
+
+	seen := map[string]string{}
+	for name, key := range keys {
+		if other, exists := seen[key]; exists {
+			t.Fatalf(`expected different shared cache keys for "%v" and "%v", got "%v"`, name, other, key)
+		}
+		seen[key] = name
+	}
+}
+
+func Test_SharedCacheSubscriptionTenants(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenantCred := &testTokenCredential{}
+	sharedCache := &testSharedCache{entries: map[string][]byte{}}
+
+	// replica which discovered the subscriptions
+	client1 := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client1.SetSharedCache(sharedCache)
+	client1.AddTenantCredential("b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90", tenantCred)
+	client1.setSubscriptionTenants(map[string]string{"d7b0cf13-ddf7-43ea-81f1-6f659767a318": "b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90"})
+	client1.sharedCacheSet(CacheIdentifierSubscriptions, sharedCacheSubscriptions{
+		Subscriptions: map[string]*armsubscriptions.Subscription{
+			"d7b0cf13-ddf7-43ea-81f1-6f659767a318": {SubscriptionID: to.StringPtr("d7b0cf13-ddf7-43ea-81f1-6f659767a318")},
+		},
+		Tenants: client1.listSubscriptionTenants(),
+	})
+
+	// replica using the shared cache entry
+	client2 := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client2.SetSharedCache(sharedCache)
+	client2.AddTenantCredential("b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90", tenantCred)
+
+	list, err := client2.ListCachedSubscriptions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := list["d7b0cf13-ddf7-43ea-81f1-6f659767a318"]; !exists {
+		t.Fatalf(`expected subscription from shared cache, got %v`, list)
+	}
+
+	if cred := client2.GetCredForSubscription("d7b0cf13-ddf7-43ea-81f1-6f659767a318"); cred != tenantCred {
+		t.Fatalf(`expected tenant credential for subscription from shared cache`)
+	}
+}
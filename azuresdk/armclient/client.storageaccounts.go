@@ -0,0 +1,70 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheIdentifierStorageAccounts = "storageaccounts:%s"
+)
+
+// ListCachedStorageAccounts return cached list of Azure StorageAccounts for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListCachedStorageAccounts(ctx context.Context, subscriptionID string) ([]*armstorage.Account, error) {
+	result, err := azureClient.cacheData(ctx, fmt.Sprintf(CacheIdentifierStorageAccounts, subscriptionID), func(ctx context.Context) (interface{}, error) {
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debug("updating cached Azure StorageAccount list")
+		list, err := azureClient.listStorageAccounts(ctx, subscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		azureClient.logger.With(zap.String("subscriptionID", subscriptionID)).Debugf("found %v Azure StorageAccounts", len(list))
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, result.([]*armstorage.Account), func(account *armstorage.Account) *string { return account.Location }), nil
+}
+
+// ListStorageAccounts return list of Azure StorageAccounts (incl. primary endpoints and sku) for subscription (filtered by location filter)
+func (azureClient *ArmClient) ListStorageAccounts(ctx context.Context, subscriptionID string) ([]*armstorage.Account, error) {
+	list, err := azureClient.listStorageAccounts(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterListByLocation(azureClient, list, func(account *armstorage.Account) *string { return account.Location }), nil
+}
+
+// listStorageAccounts return unfiltered list of Azure StorageAccounts for subscription and updates cache
+func (azureClient *ArmClient) listStorageAccounts(ctx context.Context, subscriptionID string) ([]*armstorage.Account, error) {
+	list := []*armstorage.Account{}
+
+	client, err := armstorage.NewAccountsClient(subscriptionID, azureClient.GetCredForSubscription(subscriptionID), azureClient.NewArmClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Value == nil {
+			continue
+		}
+
+		list = append(list, result.Value...)
+	}
+
+	// update cache (unfiltered, location filter is applied when list is returned)
+	azureClient.cacheSetDefault(fmt.Sprintf(CacheIdentifierStorageAccounts, subscriptionID), list)
+
+	return list, nil
+}
@@ -4,13 +4,27 @@ import (
 	"context"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/webdevops/go-common/utils/to"
 )
 
 const (
 	CacheIdentifierSubscriptions = "subscriptions"
 )
 
+type (
+	// sharedCacheSubscriptions is the shared cache entry of the subscription list
+	sharedCacheSubscriptions struct {
+		Subscriptions map[string]*armsubscriptions.Subscription `json:"subscriptions"`
+
+		// Tenants contains the tenant of subscriptions (key is subscription id, empty tenant id for subscriptions of the default credential)
+		Tenants map[string]string `json:"tenants,omitempty"`
+	}
+)
+
 // ListCachedSubscriptionsWithFilter return list of subscription with filter by subscription ids
 func (azureClient *ArmClient) ListCachedSubscriptionsWithFilter(ctx context.Context, subscriptionFilter ...string) (map[string]*armsubscriptions.Subscription, error) {
 	availableSubscriptions, err := azureClient.ListCachedSubscriptions(ctx)
@@ -36,16 +50,54 @@ func (azureClient *ArmClient) ListCachedSubscriptionsWithFilter(ctx context.Cont
 }
 
 // ListCachedSubscriptions return cached list of Azure Subscriptions as map (key is subscription id)
+//
+//	returns a copy of the cached list, so the list can be modified by the caller,
+//	the subscriptions are shared with the cache and must not be modified
 func (azureClient *ArmClient) ListCachedSubscriptions(ctx context.Context) (map[string]*armsubscriptions.Subscription, error) {
-	result, err := azureClient.cacheData(CacheIdentifierSubscriptions, func() (interface{}, error) {
+	list, err := azureClient.listCachedSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheCopyMap(list), nil
+}
+
+// listCachedSubscriptions return cached list of Azure Subscriptions as map (key is subscription id), list is shared and must not be modified
+func (azureClient *ArmClient) listCachedSubscriptions(ctx context.Context) (map[string]*armsubscriptions.Subscription, error) {
+	ctx, span := azureClient.startSpan(ctx, "ListCachedSubscriptions")
+	cacheHit := true
+	result, err := azureClient.cacheData(ctx, CacheIdentifierSubscriptions, func(ctx context.Context) (interface{}, error) {
+		cacheHit = false
+		sharedEntry := sharedCacheSubscriptions{}
+		if azureClient.sharedCacheGet(CacheIdentifierSubscriptions, &sharedEntry) && sharedEntry.Subscriptions != nil {
+			// restore tenants of subscriptions, so the matching tenant credential is used (see GetCredForSubscription),
+			// subscriptions without tenant are subscriptions of the default credential
+			tenants := map[string]string{}
+			for subscriptionID := range sharedEntry.Subscriptions {
+				tenants[subscriptionID] = ""
+			}
+			for subscriptionID, tenantID := range sharedEntry.Tenants {
+				tenants[subscriptionID] = tenantID
+			}
+			azureClient.setSubscriptionTenants(tenants)
+			azureClient.logger.Debugf("using %v Azure Subscriptions from shared cache", len(sharedEntry.Subscriptions))
+			return sharedEntry.Subscriptions, nil
+		}
+
 		azureClient.logger.Debug("updating cached Azure Subscription list")
 		list, err := azureClient.ListSubscriptions(ctx)
 		if err != nil {
 			return nil, err
 		}
 		azureClient.logger.Debugf("found %v Azure Subscriptions", len(list))
+		azureClient.sharedCacheSet(CacheIdentifierSubscriptions, sharedCacheSubscriptions{
+			Subscriptions: list,
+			Tenants:       azureClient.listSubscriptionTenants(),
+		})
 		return list, nil
 	})
+	span.SetAttributes(attribute.Bool("cache.hit", cacheHit))
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -54,19 +106,67 @@ func (azureClient *ArmClient) ListCachedSubscriptions(ctx context.Context) (map[
 }
 
 // ListSubscriptions return list of Azure Subscriptions as map (key is subscription id)
-func (azureClient *ArmClient) ListSubscriptions(ctx context.Context) (map[string]*armsubscriptions.Subscription, error) {
-	list := map[string]*armsubscriptions.Subscription{}
+//
+//	subscriptions of additional tenants (see AddTenantCredential) are aggregated and deduplicated by subscription id
+//	(case-insensitive, subscriptions of the default credential take precedence), additional tenants which cannot be
+//	listed are skipped with a warning
+func (azureClient *ArmClient) ListSubscriptions(ctx context.Context) (list map[string]*armsubscriptions.Subscription, err error) {
+	ctx, span := azureClient.startSpan(ctx, "ListSubscriptions")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	list = map[string]*armsubscriptions.Subscription{}
+
+	if err := azureClient.listSubscriptionsWithCred(ctx, azureClient.GetCred(), list); err != nil {
+		return nil, err
+	}
+
+	// subscriptions of default credential (empty tenant id, see GetCredForSubscription)
+	tenants := map[string]string{}
+	subscriptionIDs := make(map[string]bool, len(list))
+	for subscriptionID := range list {
+		subscriptionIDs[strings.ToLower(subscriptionID)] = true
+		tenants[subscriptionID] = ""
+	}
+
+	for tenantID, cred := range azureClient.listTenantCredentials() {
+		tenantList := map[string]*armsubscriptions.Subscription{}
+		if err := azureClient.listSubscriptionsWithCred(ctx, cred, tenantList); err != nil {
+			azureClient.logger.Warnf(`unable to list Azure Subscriptions of tenant "%v": %v`, tenantID, err)
+			continue
+		}
 
-	client, err := armsubscriptions.NewClient(azureClient.GetCred(), azureClient.NewArmClientOptions())
+		for subscriptionID, subscription := range tenantList {
+			if !subscriptionIDs[strings.ToLower(subscriptionID)] {
+				subscriptionIDs[strings.ToLower(subscriptionID)] = true
+				list[subscriptionID] = subscription
+				tenants[subscriptionID] = tenantID
+			}
+		}
+	}
+
+	// tenants of subscriptions which are no longer found are removed
+	azureClient.setSubscriptionTenants(tenants)
+
+	// update cache
+	azureClient.cacheSetDefault(CacheIdentifierSubscriptions, list)
+
+	return list, nil
+}
+
+// listSubscriptionsWithCred adds Azure Subscriptions accessible by credential to list
+func (azureClient *ArmClient) listSubscriptionsWithCred(ctx context.Context, cred azcore.TokenCredential, list map[string]*armsubscriptions.Subscription) error {
+	client, err := armsubscriptions.NewClient(cred, azureClient.NewArmClientOptions())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	pager := client.NewListPager(nil)
 	for pager.More() {
 		result, err := pager.NextPage(ctx)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		if result.Value == nil {
@@ -74,6 +174,12 @@ func (azureClient *ArmClient) ListSubscriptions(ctx context.Context) (map[string
 		}
 
 		for _, subscription := range result.Value {
+			if azureClient.isSubscriptionStateExcluded(subscription) {
+				azureClient.logger.Debugf(`skipping Azure Subscription "%v" with state "%v"`, to.String(subscription.SubscriptionID), string(*subscription.State))
+				metricSubscriptionsSkipped.WithLabelValues(string(*subscription.State)).Inc()
+				continue
+			}
+
 			if len(azureClient.subscriptionFilter) > 0 {
 				// use subscription filter
 				for _, subscriptionId := range azureClient.subscriptionFilter {
@@ -88,8 +194,20 @@ func (azureClient *ArmClient) ListSubscriptions(ctx context.Context) (map[string
 		}
 	}
 
-	// update cache
-	azureClient.cache.SetDefault(CacheIdentifierSubscriptions, list)
+	return nil
+}
 
-	return list, nil
+// isSubscriptionStateExcluded checks if subscription state is excluded (see SetSubscriptionExcludedStates)
+func (azureClient *ArmClient) isSubscriptionStateExcluded(subscription *armsubscriptions.Subscription) bool {
+	if subscription.State == nil {
+		return false
+	}
+
+	for _, state := range azureClient.subscriptionExcludedStates {
+		if strings.EqualFold(string(*subscription.State), string(state)) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -104,7 +104,7 @@ func (tagmgr *ArmClientTagManager) GetResourceTag(ctx context.Context, resourceI
 			// get resourceGroup
 			if azureResourceGroup == nil {
 				resourceGroupName := strings.ToLower(resourceInfo.ResourceGroup)
-				if list, err := tagmgr.client.ListCachedResourceGroups(ctx, resourceInfo.Subscription); err == nil {
+				if list, err := tagmgr.client.listCachedResourceGroups(ctx, resourceInfo.Subscription); err == nil {
 					if val, exists := list[resourceGroupName]; exists {
 						azureResourceGroup = val
 					} else {
@@ -124,7 +124,7 @@ func (tagmgr *ArmClientTagManager) GetResourceTag(ctx context.Context, resourceI
 		case AzureTagSourceSubscription:
 			// get subscription
 			if azureSubscription == nil {
-				if list, err := tagmgr.client.ListCachedSubscriptions(ctx); err == nil {
+				if list, err := tagmgr.client.listCachedSubscriptions(ctx); err == nil {
 					if val, exists := list[resourceInfo.Subscription]; exists {
 						azureSubscription = val
 					} else {
@@ -253,7 +253,7 @@ func (tagmgr *ArmClientTagManager) GetResourceTag(ctx context.Context, resourceI
 // GetCachedTagsForResource returns list of cached tags per resource
 func (tagmgr *ArmClientTagManager) GetCachedTagsForResource(ctx context.Context, resourceID string) (*armresources.Tags, error) {
 	identifier := "tags:" + resourceID
-	result, err := tagmgr.client.cacheData(identifier, func() (interface{}, error) {
+	result, err := tagmgr.client.cacheData(ctx, identifier, func(ctx context.Context) (interface{}, error) {
 		list, err := tagmgr.GetTagsForResource(ctx, resourceID)
 		if err != nil {
 			return list, err
@@ -274,7 +274,7 @@ func (tagmgr *ArmClientTagManager) GetTagsForResource(ctx context.Context, resou
 		return nil, err
 	}
 
-	client, err := armresources.NewTagsClient(resourceInfo.Subscription, tagmgr.client.GetCred(), tagmgr.client.NewArmClientOptions())
+	client, err := armresources.NewTagsClient(resourceInfo.Subscription, tagmgr.client.GetCredForSubscription(resourceInfo.Subscription), tagmgr.client.NewArmClientOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -287,6 +287,57 @@ func (tagmgr *ArmClientTagManager) GetTagsForResource(ctx context.Context, resou
 	return tags.TagsResource.Properties, nil
 }
 
+// RemoveResourceTags removes tags (by tag name, case-insensitive) from resource, not existing tags are ignored
+func (tagmgr *ArmClientTagManager) RemoveResourceTags(ctx context.Context, resourceID string, keys []string) error {
+	resourceInfo, err := ParseResourceId(resourceID)
+	if err != nil {
+		return err
+	}
+
+	currentTags, err := tagmgr.GetTagsForResource(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	// only delete existing tags (as name/value pairs)
+	deleteTags := map[string]*string{}
+	if currentTags != nil {
+		for tagName, tagValue := range currentTags.Tags {
+			for _, key := range keys {
+				if strings.EqualFold(tagName, key) {
+					deleteTags[tagName] = tagValue
+					break
+				}
+			}
+		}
+	}
+
+	if len(deleteTags) == 0 {
+		return nil
+	}
+
+	client, err := armresources.NewTagsClient(resourceInfo.Subscription, tagmgr.client.GetCredForSubscription(resourceInfo.Subscription), tagmgr.client.NewArmClientOptions())
+	if err != nil {
+		return err
+	}
+
+	operation := armresources.TagsPatchOperationDelete
+	parameters := armresources.TagsPatchResource{
+		Operation: &operation,
+		Properties: &armresources.Tags{
+			Tags: deleteTags,
+		},
+	}
+	if _, err := client.UpdateAtScope(ctx, resourceID, parameters, nil); err != nil {
+		return err
+	}
+
+	// invalidate cached tags
+	tagmgr.client.cacheDelete("tags:" + resourceID)
+
+	return nil
+}
+
 func (tagmgr *ArmClientTagManager) ParseTagConfig(tags []string) (*ResourceTagManager, error) {
 	return tagmgr.ParseTagConfigWithCustomPrefix(tags, AzurePrometheusLabelPrefix)
 }
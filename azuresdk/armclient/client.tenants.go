@@ -0,0 +1,127 @@
+package armclient
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// AddTenantCredential adds credential for an additional Azure AD tenant, subscriptions of all tenants are aggregated
+// (invalidates cached subscription list)
+func (azureClient *ArmClient) AddTenantCredential(tenantID string, cred azcore.TokenCredential) {
+	azureClient.tenant.lock.Lock()
+	azureClient.tenant.creds[strings.ToLower(tenantID)] = cred
+	azureClient.tenant.lock.Unlock()
+
+	// subscriptions of the new tenant are resolved with the next subscription list
+	azureClient.cacheDelete(CacheIdentifierSubscriptions)
+}
+
+// GetCredForSubscription returns Azure ARM credential for subscription (credential of the tenant the subscription was found in)
+//
+//	tenants of subscriptions are resolved using the (cached) subscription list if the subscription is unknown,
+//	so per subscription calls also work before subscriptions are listed (eg. with SetConnectSkipSubscriptionList)
+func (azureClient *ArmClient) GetCredForSubscription(subscriptionID string) azcore.TokenCredential {
+	subscriptionID = strings.ToLower(subscriptionID)
+
+	cred, known := azureClient.lookupSubscriptionCred(subscriptionID)
+	if !known {
+		// subscription list stores the tenants of all subscriptions found by additional tenant credentials
+		ctx, cancel := azureClient.operationContext(context.Background())
+		defer cancel()
+		if _, err := azureClient.listCachedSubscriptions(ctx); err != nil {
+			azureClient.logger.Warnf(`unable to resolve tenant of Azure Subscription "%v": %v`, subscriptionID, err)
+		}
+
+		cred, _ = azureClient.lookupSubscriptionCred(subscriptionID)
+	}
+
+	if cred != nil {
+		return cred
+	}
+
+	return azureClient.GetCred()
+}
+
+// lookupSubscriptionCred returns credential of the additional tenant of subscription (subscription id needs to be lowercased),
+// credential is nil for subscriptions of the default credential,
+// known is false if additional tenants are configured but the tenant of the subscription is not resolved yet
+func (azureClient *ArmClient) lookupSubscriptionCred(subscriptionID string) (cred azcore.TokenCredential, known bool) {
+	azureClient.tenant.lock.RLock()
+	defer azureClient.tenant.lock.RUnlock()
+
+	if len(azureClient.tenant.creds) == 0 {
+		return nil, true
+	}
+
+	if tenantID, exists := azureClient.tenant.subscriptions[subscriptionID]; exists {
+		if tenantID == "" {
+			// subscription of default credential
+			return nil, true
+		}
+		return azureClient.tenant.creds[tenantID], true
+	}
+
+	return nil, false
+}
+
+// listCredentials returns default credential followed by the credentials of additional tenants (sorted by tenant id),
+// used for scopes where the tenant is not known (eg. management groups)
+func (azureClient *ArmClient) listCredentials() []azcore.TokenCredential {
+	tenantCreds := azureClient.listTenantCredentials()
+
+	tenantIDs := make([]string, 0, len(tenantCreds))
+	for tenantID := range tenantCreds {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	list := []azcore.TokenCredential{azureClient.GetCred()}
+	for _, tenantID := range tenantIDs {
+		list = append(list, tenantCreds[tenantID])
+	}
+
+	return list
+}
+
+// listTenantCredentials returns list of additional tenant credentials (key is tenant id)
+func (azureClient *ArmClient) listTenantCredentials() map[string]azcore.TokenCredential {
+	azureClient.tenant.lock.RLock()
+	defer azureClient.tenant.lock.RUnlock()
+
+	list := make(map[string]azcore.TokenCredential, len(azureClient.tenant.creds))
+	for tenantID, cred := range azureClient.tenant.creds {
+		list[tenantID] = cred
+	}
+
+	return list
+}
+
+// setSubscriptionTenants replaces the tenants of subscriptions (key is subscription id, empty tenant id for subscriptions
+// of the default credential), subscriptions which are no longer found are removed
+func (azureClient *ArmClient) setSubscriptionTenants(tenants map[string]string) {
+	list := make(map[string]string, len(tenants))
+	for subscriptionID, tenantID := range tenants {
+		list[strings.ToLower(subscriptionID)] = strings.ToLower(tenantID)
+	}
+
+	azureClient.tenant.lock.Lock()
+	defer azureClient.tenant.lock.Unlock()
+
+	azureClient.tenant.subscriptions = list
+}
+
+// listSubscriptionTenants returns tenants of subscriptions (key is subscription id, empty tenant id for subscriptions of the default credential)
+func (azureClient *ArmClient) listSubscriptionTenants() map[string]string {
+	azureClient.tenant.lock.RLock()
+	defer azureClient.tenant.lock.RUnlock()
+
+	list := make(map[string]string, len(azureClient.tenant.subscriptions))
+	for subscriptionID, tenantID := range azureClient.tenant.subscriptions {
+		list[subscriptionID] = tenantID
+	}
+
+	return list
+}
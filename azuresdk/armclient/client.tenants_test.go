@@ -0,0 +1,148 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+// testTenantTokenCredential returns a fixed token (or error) to identify the tenant of requests
+type testTenantTokenCredential struct {
+	token string
+	err   error
+}
+
+func (cred *testTenantTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if cred.err != nil {
+		return azcore.AccessToken{}, cred.err
+	}
+	return azcore.AccessToken{Token: cred.token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// testTenantTransport returns subscriptions by token (key is token, value is subscription id),
+// management group policy assignments are only returned for token of managementGroupTenant
+type testTenantTransport struct {
+	subscriptions         map[string]string
+	managementGroupTenant string
+}
+
+func (transport *testTenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	statusCode := http.StatusOK
+	content := `{"value":[]}`
+	switch {
+	case strings.Contains(req.URL.Path, "/managementGroups/"):
+		if token == transport.managementGroupTenant {
+			content = `{"value":[{"id":"/providers/Microsoft.Management/managementGroups/test/providers/Microsoft.Authorization/policyAssignments/test","name":"test"}]}`
+		} else {
+			statusCode = http.StatusForbidden
+			content = `{"error":{"code":"AuthorizationFailed","message":"no access"}}`
+		}
+	default:
+		if subscriptionID, exists := transport.subscriptions[token]; exists {
+			content = fmt.Sprintf(`{"value":[{"subscriptionId":"%v","displayName":"test","state":"Enabled"}]}`, subscriptionID)
+		}
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(content)),
+		Request:    req,
+	}, nil
+}
+
+func Test_GetCredForSubscriptionNotListed(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenantCred := &testTenantTokenCredential{token: "tenant"}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetHTTPClient(&http.Client{Transport: &testTenantTransport{
+		subscriptions: map[string]string{
+			"default": "d7b0cf13-ddf7-43ea-81f1-6f659767a318",
+			"tenant":  "0A4D3C1B-1F2E-4D5C-8B7A-6E5F4D3C2B1A",
+		},
+	}})
+	if err := client.UseCredentialChain(&testTenantTokenCredential{token: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	client.AddTenantCredential("B3C1E2A4-4D8F-4F0E-9D61-2F3C5A7B8E90", tenantCred)
+	// failing tenant must not fail the subscription listing
+	client.AddTenantCredential("c4d2f3b5-5e9a-4a1f-8e72-3a4d6b8c9fa1", &testTenantTokenCredential{err: fmt.Errorf("tenant not available")})
+
+	// tenant of subscription is resolved without prior subscription listing (case-insensitive)
+	if cred := client.GetCredForSubscription("0a4d3c1b-1f2e-4d5c-8b7a-6e5f4d3c2b1a"); cred != tenantCred {
+		t.Fatalf(`expected tenant credential for subscription of additional tenant`)
+	}
+
+	if cred := client.GetCredForSubscription("D7B0CF13-DDF7-43EA-81F1-6F659767A318"); cred == tenantCred {
+		t.Fatalf(`expected default credential for subscription of default tenant`)
+	}
+
+	// subscription of default tenant is known after listing
+	if cred, known := client.lookupSubscriptionCred("d7b0cf13-ddf7-43ea-81f1-6f659767a318"); !known || cred != nil {
+		t.Fatalf(`expected subscription of default tenant to be known`)
+	}
+
+	list, err := client.ListCachedSubscriptions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf(`expected subscriptions of default and additional tenant, got %v`, list)
+	}
+
+	// tenants of subscriptions which are no longer found are removed
+	client.SetHTTPClient(&http.Client{Transport: &testTenantTransport{
+		subscriptions: map[string]string{"default": "d7b0cf13-ddf7-43ea-81f1-6f659767a318"},
+	}})
+	if _, err := client.ListSubscriptions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tenants := client.listSubscriptionTenants(); len(tenants) != 1 || tenants["d7b0cf13-ddf7-43ea-81f1-6f659767a318"] != "" {
+		t.Fatalf(`expected tenants of removed subscriptions to be pruned, got %v`, tenants)
+	}
+}
+
+func Test_ListPolicyAssignmentsManagementGroupTenant(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetHTTPClient(&http.Client{Transport: &testTenantTransport{managementGroupTenant: "tenant"}})
+	if err := client.UseCredentialChain(&testTenantTokenCredential{token: "default"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// management group is not accessible by default credential
+	if _, err := client.ListPolicyAssignments(context.Background(), "/providers/Microsoft.Management/managementGroups/test"); err == nil {
+		t.Fatalf(`expected error for management group of other tenant`)
+	}
+
+	// management group is located in additional tenant
+	client.AddTenantCredential("b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90", &testTenantTokenCredential{token: "tenant"})
+	list, err := client.ListPolicyAssignments(context.Background(), "/providers/Microsoft.Management/managementGroups/test")
+	if err != nil {
+		t.Fatalf(`expected policy assignments of management group in additional tenant, got: %v`, err)
+	}
+	if len(list) != 1 {
+		t.Fatalf(`expected 1 policy assignment, got %v`, len(list))
+	}
+}
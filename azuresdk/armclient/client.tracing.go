@@ -0,0 +1,41 @@
+package armclient
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+// SetTracerProvider enables OpenTelemetry spans for ArmClient operations (nil disables tracing)
+func (azureClient *ArmClient) SetTracerProvider(tracerProvider trace.TracerProvider) {
+	if tracerProvider == nil {
+		azureClient.tracer = nil
+		return
+	}
+
+	azureClient.tracer = tracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts new span as child of ctx, returns noop span if tracing is disabled
+func (azureClient *ArmClient) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if azureClient.tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	return azureClient.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records error (if any) and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
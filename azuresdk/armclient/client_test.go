@@ -0,0 +1,95 @@
+package armclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+type testTokenCredential struct{}
+
+func (cred *testTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "test", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func Test_TransportConcurrent(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+
+	// transport settings are changed while clients are created (run with -race)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			client.SetTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+			client.SetMaxIdleConns(i + 1)
+			client.SetMaxConnsPerHost(i + 1)
+		}(i)
+		go func() {
+			defer wg.Done()
+			client.NewArmClientOptions()
+			client.NewAzCoreClientOptions()
+		}()
+	}
+	wg.Wait()
+
+	client.SetMaxConnsPerHost(5)
+	if transport := client.getTransport(); transport == nil || transport.Transport.(*http.Transport).MaxConnsPerHost != 5 {
+		t.Fatalf(`expected transport with max 5 connections per host`)
+	}
+}
+
+func Test_RefreshCredentialConcurrent(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	if err := client.UseCredentialChain(&testTokenCredential{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// credential is replaced, refreshed, reset by cloud reload and read concurrently (run with -race)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			if err := client.RefreshCredential(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := client.UseCredentialChain(&testTokenCredential{}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			client.ReloadCloudConfig(cloudConfig)
+		}()
+		go func() {
+			defer wg.Done()
+			if client.GetCred() == nil {
+				t.Error(`expected credential`)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package armclient
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// IsRetryableError returns if error is temporary and call can be retried (throttling, server errors and network timeouts)
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// IsThrottled returns if error is caused by Azure API throttling (HTTP status 429)
+func IsThrottled(err error) bool {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+// IsMissingSubscriptionRegistration returns if error is caused by a resource provider which is not registered for the subscription
+func IsMissingSubscriptionRegistration(err error) bool {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.ErrorCode == "MissingSubscriptionRegistration"
+	}
+
+	return false
+}
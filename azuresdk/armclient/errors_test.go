@@ -0,0 +1,77 @@
+package armclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+type testTimeoutError struct{}
+
+func (e testTimeoutError) Error() string   { return "timeout" }
+func (e testTimeoutError) Timeout() bool   { return true }
+func (e testTimeoutError) Temporary() bool { return true }
+
+func Test_IsRetryableError(t *testing.T) {
+	errorList := map[error]bool{
+		nil:                  false,
+		errors.New("foobar"): false,
+		context.Canceled:     false,
+		testTimeoutError{}:   true,
+		fmt.Errorf("wrapped: %w", testTimeoutError{}): true,
+	}
+
+	for _, statusCode := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		errorList[&azcore.ResponseError{StatusCode: statusCode}] = true
+	}
+
+	for _, statusCode := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict} {
+		errorList[&azcore.ResponseError{StatusCode: statusCode}] = false
+	}
+
+	for err, expected := range errorList {
+		if result := IsRetryableError(err); result != expected {
+			t.Errorf(`expected IsRetryableError to return %v for "%#v", got %v`, expected, err, result)
+		}
+	}
+}
+
+func Test_IsThrottled(t *testing.T) {
+	if !IsThrottled(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests}) {
+		t.Errorf(`expected HTTP 429 to be throttled`)
+	}
+
+	if !IsThrottled(fmt.Errorf("wrapped: %w", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests})) {
+		t.Errorf(`expected wrapped HTTP 429 to be throttled`)
+	}
+
+	if IsThrottled(&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Errorf(`expected HTTP 503 not to be throttled`)
+	}
+
+	if IsThrottled(nil) {
+		t.Errorf(`expected nil not to be throttled`)
+	}
+}
+
+func Test_IsMissingSubscriptionRegistration(t *testing.T) {
+	if !IsMissingSubscriptionRegistration(&azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "MissingSubscriptionRegistration"}) {
+		t.Errorf(`expected MissingSubscriptionRegistration error code to be detected`)
+	}
+
+	if !IsMissingSubscriptionRegistration(fmt.Errorf("wrapped: %w", &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "MissingSubscriptionRegistration"})) {
+		t.Errorf(`expected wrapped MissingSubscriptionRegistration error code to be detected`)
+	}
+
+	if IsMissingSubscriptionRegistration(&azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "Conflict"}) {
+		t.Errorf(`expected other error code not to be detected`)
+	}
+
+	if IsMissingSubscriptionRegistration(nil) {
+		t.Errorf(`expected nil not to be detected`)
+	}
+}
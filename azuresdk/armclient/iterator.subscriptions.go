@@ -62,7 +62,12 @@ func (i *SubscriptionsIterator) ForEach(logger *zap.SugaredLogger, callback func
 			zap.String(`subscriptionID`, *subscription.SubscriptionID),
 			zap.String(`subscriptionName`, *subscription.DisplayName),
 		)
-		callback(subscription, contextLogger)
+
+		func() {
+			release, _ := i.client.acquireGlobalConcurrency(context.Background())
+			defer release()
+			callback(subscription, contextLogger)
+		}()
 	}
 
 	return nil
@@ -84,6 +89,11 @@ func (i *SubscriptionsIterator) ForEachAsync(logger *zap.SugaredLogger, callback
 
 		go func(subscription *armsubscriptions.Subscription) {
 			defer wg.Done()
+
+			// limit concurrent callbacks of all iterators (see ArmClient.SetGlobalConcurrency)
+			release, _ := i.client.acquireGlobalConcurrency(context.Background())
+			defer release()
+
 			contextLogger := logger.With(
 				zap.String(`subscriptionID`, *subscription.SubscriptionID),
 				zap.String(`subscriptionName`, *subscription.DisplayName),
@@ -131,9 +141,13 @@ func (i *SubscriptionsIterator) ListSubscriptions() (map[string]*armsubscription
 	if i.subscriptions != nil {
 		list = *i.subscriptions
 	} else {
-		if result, err := i.client.ListCachedSubscriptions(context.Background()); err == nil {
-			list = result
-		} else {
+		// requests are already retried by the SDK pipeline, only retry once more if the SDK retries are exhausted
+		ctx := context.Background()
+		err := Retry(ctx, func() (err error) {
+			list, err = i.client.ListCachedSubscriptions(ctx)
+			return err
+		}, RetryOptions{MaxAttempts: 2})
+		if err != nil {
 			return list, err
 		}
 	}
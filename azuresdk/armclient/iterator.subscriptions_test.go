@@ -0,0 +1,106 @@
+package armclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"go.uber.org/zap"
+
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+func Test_SubscriptionsIteratorGlobalConcurrency(t *testing.T) {
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	client.SetGlobalConcurrency(2)
+
+	subscriptions := map[string]*armsubscriptions.Subscription{}
+	for num := 0; num < 6; num++ {
+		subscriptionID := fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", num)
+		subscriptions[subscriptionID] = &armsubscriptions.Subscription{
+			SubscriptionID: to.StringPtr(subscriptionID),
+			DisplayName:    to.StringPtr(subscriptionID),
+		}
+	}
+
+	var running, maxRunning int32
+	callback := func(subscription *armsubscriptions.Subscription, logger *zap.SugaredLogger) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			val := atomic.LoadInt32(&maxRunning)
+			if current <= val || atomic.CompareAndSwapInt32(&maxRunning, val, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// callbacks of multiple iterators (eg. multiple collectors) share the global limit
+	wg := sync.WaitGroup{}
+	for num := 0; num < 3; num++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			iterator := &SubscriptionsIterator{client: client, subscriptions: &subscriptions, concurrency: 10}
+			if err := iterator.ForEachAsync(zap.NewNop().Sugar(), callback); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val := atomic.LoadInt32(&maxRunning); val != 2 {
+		t.Fatalf(`expected 2 concurrent callbacks, got %v`, val)
+	}
+
+	// sequential iterator callbacks also respect the limit
+	client.SetGlobalConcurrency(1)
+	atomic.StoreInt32(&maxRunning, 0)
+	for num := 0; num < 3; num++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			iterator := &SubscriptionsIterator{client: client, subscriptions: &subscriptions}
+			if err := iterator.ForEach(zap.NewNop().Sugar(), callback); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val := atomic.LoadInt32(&maxRunning); val != 1 {
+		t.Fatalf(`expected 1 concurrent callback, got %v`, val)
+	}
+
+	// limit is changed while slots are acquired (run with -race)
+	for num := 0; num < 10; num++ {
+		wg.Add(2)
+		go func(num int) {
+			defer wg.Done()
+			client.SetGlobalConcurrency(num % 3)
+		}(num)
+		go func() {
+			defer wg.Done()
+			release, err := client.acquireGlobalConcurrency(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+}
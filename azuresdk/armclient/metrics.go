@@ -0,0 +1,35 @@
+package armclient
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricTokenExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_token_expiry_timestamp_seconds",
+			Help: "Azure access token expiry timestamp",
+		},
+		[]string{
+			"appID",
+			"tenantID",
+		},
+	)
+
+	metricSubscriptionsSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_subscriptions_skipped",
+			Help: "Count of Azure Subscriptions skipped because of excluded state",
+		},
+		[]string{
+			"state",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricTokenExpiry,
+		metricSubscriptionsSkipped,
+	)
+}
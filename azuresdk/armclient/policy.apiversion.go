@@ -0,0 +1,88 @@
+package armclient
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type (
+	apiVersionPolicy struct {
+		overrides *apiVersionOverrides
+	}
+
+	apiVersionOverrides struct {
+		lock     sync.RWMutex
+		versions map[string]string
+	}
+)
+
+// newApiVersionPolicy creates policy which overrides api-version query parameter for requests of matching resource types
+func newApiVersionPolicy(overrides *apiVersionOverrides) apiVersionPolicy {
+	return apiVersionPolicy{overrides: overrides}
+}
+
+func (p apiVersionPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if version, exists := p.overrides.get(apiVersionResourceType(req.Raw().URL.Path)); exists {
+		query := req.Raw().URL.Query()
+		query.Set("api-version", version)
+		req.Raw().URL.RawQuery = query.Encode()
+	}
+
+	return req.Next()
+}
+
+func (o *apiVersionOverrides) set(resourceType, version string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.versions == nil {
+		o.versions = map[string]string{}
+	}
+
+	resourceType = strings.ToLower(strings.Trim(resourceType, "/"))
+	if version != "" {
+		o.versions[resourceType] = version
+	} else {
+		delete(o.versions, resourceType)
+	}
+}
+
+func (o *apiVersionOverrides) get(resourceType string) (string, bool) {
+	if resourceType == "" {
+		return "", false
+	}
+
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	version, exists := o.versions[resourceType]
+	return version, exists
+}
+
+// apiVersionResourceType returns the (lowercased) resource type (eg. microsoft.network/virtualnetworks/subnets) of request path
+//
+//	uses the last provider in path (eg. for extension resources)
+func apiVersionResourceType(path string) string {
+	path = strings.ToLower(path)
+
+	pos := strings.LastIndex(path, "/providers/")
+	if pos == -1 {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(path[pos+len("/providers/"):], "/"), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		return ""
+	}
+
+	// namespace followed by type/name pairs
+	resourceType := []string{parts[0]}
+	for i := 1; i < len(parts); i += 2 {
+		resourceType = append(resourceType, parts[i])
+	}
+
+	return strings.Join(resourceType, "/")
+}
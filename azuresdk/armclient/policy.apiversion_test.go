@@ -0,0 +1,41 @@
+package armclient
+
+import (
+	"testing"
+)
+
+func Test_ApiVersionResourceType(t *testing.T) {
+	paths := map[string]string{
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/providers/Microsoft.Network/virtualNetworks":                                                                               "microsoft.network/virtualnetworks",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/foo-rg/providers/Microsoft.Network/virtualNetworks/vnet":                                                    "microsoft.network/virtualnetworks",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/foo-rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets":                                            "microsoft.network/virtualnetworks/subnets",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/foo-rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/default/":                                   "microsoft.network/virtualnetworks/subnets",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/foo-rg/providers/Microsoft.Storage/storageAccounts/foo/providers/Microsoft.Insights/diagnosticSettings/bar": "microsoft.insights/diagnosticsettings",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/foo-rg":                                                                                                     "",
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/providers/":                                                                                                                "",
+	}
+
+	for path, expected := range paths {
+		if resourceType := apiVersionResourceType(path); resourceType != expected {
+			t.Fatalf(`expected resource type "%v" for "%v", got "%v"`, expected, path, resourceType)
+		}
+	}
+}
+
+func Test_ApiVersionOverrides(t *testing.T) {
+	overrides := &apiVersionOverrides{}
+	overrides.set("Microsoft.Network/virtualNetworks", "2023-02-01")
+
+	if version, exists := overrides.get("microsoft.network/virtualnetworks"); !exists || version != "2023-02-01" {
+		t.Fatalf(`expected api version override "2023-02-01", got "%v"`, version)
+	}
+
+	if _, exists := overrides.get("microsoft.network/virtualnetworks/subnets"); exists {
+		t.Fatalf(`expected no api version override for subnets`)
+	}
+
+	overrides.set("Microsoft.Network/virtualNetworks", "")
+	if _, exists := overrides.get("microsoft.network/virtualnetworks"); exists {
+		t.Fatalf(`expected api version override to be removed`)
+	}
+}
@@ -0,0 +1,72 @@
+package armclient
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+
+	commonAzidentity "github.com/webdevops/go-common/azuresdk/azidentity"
+	"github.com/webdevops/go-common/utils/to"
+)
+
+const (
+	// tokenExpiryCacheSize is the number of remembered bearer tokens (eg. one token per tenant)
+	tokenExpiryCacheSize = 16
+)
+
+type (
+	tokenExpiryPolicy struct {
+		tokens *tokenExpiryCache
+	}
+
+	// tokenExpiryCache remembers recently seen bearer tokens, so tokens are only parsed if they change
+	tokenExpiryCache struct {
+		lock   sync.Mutex
+		tokens map[string]struct{}
+	}
+)
+
+// newTokenExpiryPolicy creates policy which updates token expiry metric from the bearer token of requests (only for new tokens)
+func newTokenExpiryPolicy(tokens *tokenExpiryCache) tokenExpiryPolicy {
+	return tokenExpiryPolicy{tokens: tokens}
+}
+
+func (p tokenExpiryPolicy) Do(req *policy.Request) (*http.Response, error) {
+	res, err := req.Next()
+	if res == nil || res.Request == nil {
+		return res, err
+	}
+
+	// authorization header is set by bearer token policy (later in pipeline), so use the sent request
+	authToken := res.Request.Header.Get("authorization")
+	if strings.HasPrefix(authToken, "Bearer") {
+		authToken = strings.TrimSpace(strings.TrimPrefix(authToken, "Bearer"))
+		if !p.tokens.seen(authToken) {
+			if tokenInfo := commonAzidentity.ParseAccessToken(azcore.AccessToken{Token: authToken}); tokenInfo != nil && tokenInfo.Exp != nil {
+				metricTokenExpiry.WithLabelValues(to.String(tokenInfo.AppId), to.String(tokenInfo.Tid)).Set(float64(*tokenInfo.Exp))
+			}
+		}
+	}
+
+	return res, err
+}
+
+// seen returns true if token was already seen, otherwise the token is remembered
+func (c *tokenExpiryCache) seen(token string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.tokens[token]; exists {
+		return true
+	}
+
+	if c.tokens == nil || len(c.tokens) >= tokenExpiryCacheSize {
+		c.tokens = map[string]struct{}{}
+	}
+	c.tokens[token] = struct{}{}
+
+	return false
+}
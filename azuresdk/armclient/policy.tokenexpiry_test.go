@@ -0,0 +1,25 @@
+package armclient
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_TokenExpiryCache(t *testing.T) {
+	cache := tokenExpiryCache{}
+
+	if cache.seen("token1") {
+		t.Fatalf(`expected new token not to be seen`)
+	}
+	if !cache.seen("token1") {
+		t.Fatalf(`expected token to be seen on subsequent requests`)
+	}
+
+	// cache is bounded (eg. rotated tokens)
+	for num := 0; num < tokenExpiryCacheSize*2; num++ {
+		cache.seen(fmt.Sprintf("token-%d", num))
+	}
+	if len(cache.tokens) > tokenExpiryCacheSize {
+		t.Fatalf(`expected at most %v cached tokens, got %v`, tokenExpiryCacheSize, len(cache.tokens))
+	}
+}
@@ -0,0 +1,98 @@
+package armclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+const (
+	RetryDefaultMaxAttempts = 3
+	RetryDefaultBaseDelay   = 1 * time.Second
+	RetryDefaultMaxDelay    = 30 * time.Second
+)
+
+type (
+	// RetryOptions configures Retry, zero values use the defaults
+	RetryOptions struct {
+		// MaxAttempts is the maximum number of attempts incl. the first call (default 3)
+		MaxAttempts int
+
+		// BaseDelay is the delay before the first retry, doubled for each further retry (default 1s)
+		BaseDelay time.Duration
+
+		// MaxDelay limits the delay between retries (default 30s)
+		MaxDelay time.Duration
+	}
+)
+
+// Retry calls op until it succeeds, returns a non retryable error (see IsRetryableError) or max attempts are reached,
+// delay between attempts grows exponentially (with jitter) and respects Retry-After of throttled responses (up to MaxDelay)
+//
+//	returns the last error of op or the context error if ctx is canceled while waiting,
+//	requests of SDK clients are already retried by the SDK pipeline, so attempts multiply if op uses SDK clients
+func Retry(ctx context.Context, op func() error, opts RetryOptions) error {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = RetryDefaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = RetryDefaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = RetryDefaultMaxDelay
+	}
+
+	var err error
+	for attempt := 0; attempt < opts.MaxAttempts; attempt++ {
+		if err = op(); err == nil || !IsRetryableError(err) {
+			return err
+		}
+
+		// no wait after last attempt
+		if attempt+1 >= opts.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay(err, attempt, opts)):
+		}
+	}
+
+	return err
+}
+
+// retryDelay returns delay before next attempt (exponential backoff with jitter, at least Retry-After of response),
+// delay is limited by MaxDelay (also for Retry-After)
+func retryDelay(err error, attempt int, opts RetryOptions) time.Duration {
+	delay := opts.BaseDelay
+	for i := 0; i < attempt && delay < opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > opts.MaxDelay {
+		delay = opts.MaxDelay
+	}
+
+	// jitter between 50% and 100% of delay to spread retries of concurrent callers
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) // #nosec:G404 random value only used for retry jitter
+
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) && responseErr.RawResponse != nil {
+		if retryAfter, err := strconv.Atoi(responseErr.RawResponse.Header.Get("Retry-After")); err == nil && retryAfter > 0 {
+			retryAfterDelay := time.Duration(retryAfter) * time.Second
+			if retryAfterDelay > opts.MaxDelay {
+				retryAfterDelay = opts.MaxDelay
+			}
+			if retryAfterDelay > delay {
+				delay = retryAfterDelay
+			}
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,91 @@
+package armclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func Test_Retry(t *testing.T) {
+	opts := RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	// retryable errors are retried until success
+	attempts := 0
+	err := Retry(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil
+	}, opts)
+	if err != nil || attempts != 3 {
+		t.Fatalf(`expected success after 3 attempts, got %v attempts and error %v`, attempts, err)
+	}
+
+	// max attempts reached, last error is returned
+	attempts = 0
+	err = Retry(context.Background(), func() error {
+		attempts++
+		return &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}
+	}, opts)
+	if !IsThrottled(err) || attempts != 3 {
+		t.Fatalf(`expected throttling error after 3 attempts, got %v attempts and error %v`, attempts, err)
+	}
+
+	// non retryable errors are returned immediately
+	attempts = 0
+	err = Retry(context.Background(), func() error {
+		attempts++
+		return &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}, opts)
+	if err == nil || attempts != 1 {
+		t.Fatalf(`expected error after 1 attempt, got %v attempts and error %v`, attempts, err)
+	}
+
+	// canceled context stops waiting for next attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = Retry(ctx, func() error {
+		attempts++
+		cancel()
+		return &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	}, RetryOptions{MaxAttempts: 3, BaseDelay: time.Hour})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Fatalf(`expected context error after 1 attempt, got %v attempts and error %v`, attempts, err)
+	}
+}
+
+func Test_RetryDelay(t *testing.T) {
+	opts := RetryOptions{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	err := errors.New("foobar")
+
+	for attempt, maxDelay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := retryDelay(err, attempt, opts); delay < maxDelay/2 || delay > maxDelay {
+			t.Errorf(`expected delay between %v and %v for attempt %v, got %v`, maxDelay/2, maxDelay, attempt, delay)
+		}
+	}
+
+	// huge attempt counts must not overflow
+	if delay := retryDelay(err, 100, opts); delay < 5*time.Second || delay > 10*time.Second {
+		t.Errorf(`expected delay to be limited by max delay, got %v`, delay)
+	}
+
+	// Retry-After of throttled response is respected
+	throttledErr := &azcore.ResponseError{
+		StatusCode:  http.StatusTooManyRequests,
+		RawResponse: &http.Response{Header: http.Header{"Retry-After": []string{"5"}}},
+	}
+	if delay := retryDelay(throttledErr, 0, opts); delay != 5*time.Second {
+		t.Errorf(`expected Retry-After delay of 5s, got %v`, delay)
+	}
+
+	// Retry-After is limited by max delay
+	throttledErr.RawResponse.Header.Set("Retry-After", "20")
+	if delay := retryDelay(throttledErr, 0, opts); delay != 10*time.Second {
+		t.Errorf(`expected Retry-After delay to be limited to 10s, got %v`, delay)
+	}
+}
@@ -16,6 +16,7 @@ type (
 		AppId *string `json:"appid"`
 		Oid   *string `json:"oid"`
 		Upn   *string `json:"upn"`
+		Exp   *int64  `json:"exp"`
 	}
 )
 
@@ -34,6 +34,10 @@ func NewCloudConfig(cloudName string) (config CloudEnvironment, err error) {
 			Audience: "https://api.loganalytics.io/",
 			Endpoint: "https://api.loganalytics.io",
 		})
+		injectServiceConfig(&config.Configuration, ServiceNameStorage, cloud.ServiceConfiguration{
+			Audience: "https://storage.azure.com/",
+			Endpoint: "core.windows.net",
+		})
 
 	// ----------------------------------------------------
 	// Azure China cloud
@@ -50,6 +54,10 @@ func NewCloudConfig(cloudName string) (config CloudEnvironment, err error) {
 			Audience: "https://api.loganalytics.azure.cn/",
 			Endpoint: "https://api.loganalytics.azure.cn",
 		})
+		injectServiceConfig(&config.Configuration, ServiceNameStorage, cloud.ServiceConfiguration{
+			Audience: "https://storage.azure.com/",
+			Endpoint: "core.chinacloudapi.cn",
+		})
 
 	// ----------------------------------------------------
 	// Azure Government cloud
@@ -66,6 +74,10 @@ func NewCloudConfig(cloudName string) (config CloudEnvironment, err error) {
 			Audience: "https://api.loganalytics.us/",
 			Endpoint: "https://api.loganalytics.us",
 		})
+		injectServiceConfig(&config.Configuration, ServiceNameStorage, cloud.ServiceConfiguration{
+			Audience: "https://storage.azure.com/",
+			Endpoint: "core.usgovcloudapi.net",
+		})
 
 	// ----------------------------------------------------
 	// Azure Private Cloud (onpremise, custom configuration via json)
@@ -18,4 +18,5 @@ const (
 	// Service name
 	ServiceNameMicrosoftGraph        cloud.ServiceName = "microsoftGraph"
 	ServiceNameLogAnalyticsWorkspace cloud.ServiceName = "logAnalytics"
+	ServiceNameStorage               cloud.ServiceName = "storage" // endpoint is the storage endpoint suffix (eg. core.windows.net)
 )
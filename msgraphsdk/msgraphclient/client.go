@@ -152,6 +152,13 @@ func (c *MsGraphClient) UseAzCliAuth() {
 	c.serviceClient = nil
 }
 
+// SetCred set credential (eg. shared credential from ArmClient.GetCred())
+func (c *MsGraphClient) SetCred(cred azcore.TokenCredential) {
+	c.cred = &cred
+	c.adapter = nil
+	c.serviceClient = nil
+}
+
 // NewAzCoreClientOptions returns new client options for all arm clients
 func (c *MsGraphClient) NewAzCoreClientOptions() *azcore.ClientOptions {
 	clientOptions := azcore.ClientOptions{
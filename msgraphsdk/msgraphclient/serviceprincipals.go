@@ -0,0 +1,62 @@
+package msgraphclient
+
+import (
+	"context"
+
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+
+	"github.com/webdevops/go-common/utils/to"
+)
+
+type (
+	GraphServicePrincipal struct {
+		ObjectID             string
+		ApplicationID        string
+		DisplayName          string
+		ServicePrincipalType string
+		AccountEnabled       bool
+		Tags                 []string
+	}
+)
+
+// ListServicePrincipals returns list of all AzureAD service principals in tenant (paged via @odata.nextLink)
+func (c *MsGraphClient) ListServicePrincipals(ctx context.Context) ([]*GraphServicePrincipal, error) {
+	ret := []*GraphServicePrincipal{}
+
+	result, err := c.ServiceClient().ServicePrincipals().Get(ctx, nil)
+	if err != nil {
+		return ret, err
+	}
+
+	pageIterator, err := msgraphcore.NewPageIterator[models.ServicePrincipalable](
+		result,
+		c.ServiceClient().GetAdapter(),
+		models.CreateServicePrincipalCollectionResponseFromDiscriminatorValue,
+	)
+	if err != nil {
+		return ret, err
+	}
+
+	err = pageIterator.Iterate(ctx, func(sp models.ServicePrincipalable) bool {
+		servicePrincipal := &GraphServicePrincipal{
+			ObjectID:             to.String(sp.GetId()),
+			ApplicationID:        to.String(sp.GetAppId()),
+			DisplayName:          to.String(sp.GetDisplayName()),
+			ServicePrincipalType: to.String(sp.GetServicePrincipalType()),
+			Tags:                 sp.GetTags(),
+		}
+
+		if accountEnabled := sp.GetAccountEnabled(); accountEnabled != nil {
+			servicePrincipal.AccountEnabled = *accountEnabled
+		}
+
+		ret = append(ret, servicePrincipal)
+		return true
+	})
+	if err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// azureSdkModule is the module used for Azure SDK version of build info
+	azureSdkModule = "github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// RegisterBuildInfo registers build_info gauge (value 1) with version, revision (commit), go version and Azure SDK (azcore) version
+// as labels, go version of the runtime is used if goVersion is empty (registry nil uses the default registry)
+//
+//	use prometheus.WrapRegistererWithPrefix for exporter specific metric names (eg. azure_resourcemanager_exporter_build_info)
+func RegisterBuildInfo(registry prometheus.Registerer, version, commit, goVersion string) error {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+
+	if goVersion == "" {
+		goVersion = runtime.Version()
+	}
+
+	buildInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Build information (version, revision, go version and Azure SDK version)",
+		},
+		[]string{
+			"version",
+			"revision",
+			"goversion",
+			"azuresdkversion",
+		},
+	)
+	buildInfo.WithLabelValues(version, commit, goVersion, azureSdkVersion()).Set(1)
+
+	return registry.Register(buildInfo)
+}
+
+// azureSdkVersion returns version of Azure SDK (azcore) from build info ("unknown" if not available)
+func azureSdkVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, module := range info.Deps {
+			if module.Path != azureSdkModule {
+				continue
+			}
+
+			// local replacements have no version, use required version instead
+			if module.Replace != nil && module.Replace.Version != "" {
+				return module.Replace.Version
+			}
+			if module.Version != "" {
+				return module.Version
+			}
+			break
+		}
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_RegisterBuildInfo(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := RegisterBuildInfo(registry, "1.2.3", "abcdef", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metricFamilies) != 1 || len(metricFamilies[0].GetMetric()) != 1 {
+		t.Fatalf(`expected one build_info metric, got %v`, metricFamilies)
+	}
+
+	labels := map[string]string{}
+	for _, label := range metricFamilies[0].GetMetric()[0].GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	expectedLabels := map[string]string{
+		"version":   "1.2.3",
+		"revision":  "abcdef",
+		"goversion": runtime.Version(),
+	}
+	for name, value := range expectedLabels {
+		if labels[name] != value {
+			t.Fatalf(`expected label %v="%v", got "%v"`, name, value, labels[name])
+		}
+	}
+
+	// azcore is linked into the test binary, so its version must be resolved from build info
+	if sdkVersion := labels["azuresdkversion"]; sdkVersion == "" || sdkVersion == "unknown" {
+		t.Fatalf(`expected Azure SDK version from build info, got "%v"`, sdkVersion)
+	}
+
+	if value := metricFamilies[0].GetMetric()[0].GetGauge().GetValue(); value != 1 {
+		t.Fatalf(`expected build_info value 1, got %v`, value)
+	}
+
+	// build info can only be registered once per registry
+	if err := RegisterBuildInfo(registry, "1.2.3", "abcdef", "go1.20"); err == nil {
+		t.Fatalf(`expected error for duplicate build info`)
+	}
+}
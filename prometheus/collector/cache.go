@@ -1,20 +1,42 @@
 package collector
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"go.uber.org/zap"
 
 	armclient "github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/azuresdk/azidentity"
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+	prometheusCommon "github.com/webdevops/go-common/prometheus"
 	"github.com/webdevops/go-common/utils/to"
 )
 
@@ -29,13 +51,140 @@ type (
 
 		spec map[string]string
 
-		client interface{}
+		client     interface{}
+		readClient interface{}
+
+		// credential used by azblob clients (nil for shared key authentication)
+		credential azcore.TokenCredential
+	}
+
+	// CacheSpec is the parsed cache spec (see ParseCacheSpec)
+	CacheSpec struct {
+		// Protocol is the cache backend (file or azblob)
+		Protocol string
+
+		// Path is the cache file path (file)
+		Path string
+
+		// Host, Container and Blob are the location of the cache blob (azblob)
+		Host      string
+		Container string
+		Blob      string
+
+		// ReadHost is the optional host used for reading the cache blob (azblob)
+		ReadHost string
+
+		// Auth is the optional authentication mode (azblob)
+		Auth string
+	}
+
+	cacheConfigDef struct {
+		blobTier       *blob.AccessTier
+		minRemaining   time.Duration
+		compactOnStart bool
+		readTimeout    time.Duration
+		writeTimeout   time.Duration
+		integrityCheck bool
+		streamSize     int64
+		snapshot       bool
+		templateVars   map[string]string
+		expiryJitter   time.Duration
+		mode           CacheMode
+		previousTags   []string
+		readOnly       bool
+		verifyWritable bool
+		metadata       map[string]string
+		exclusiveWrite bool
+		uploadOptions  struct {
+			blockSize   int64
+			concurrency uint16
+		}
+		credential azcore.TokenCredential
+		tenantID   string
+		armClient  *armclient.ArmClient
+		sharded    bool
+	}
+
+	// cacheTenantCredential requests tokens of the wrapped credential for a fixed tenant
+	cacheTenantCredential struct {
+		cred     azcore.TokenCredential
+		tenantID string
+	}
+
+	// cacheTempFile is a downloaded cache file which is removed on close
+	cacheTempFile struct {
+		*os.File
+	}
+
+	cacheIntegrityEnvelope struct {
+		Checksum string          `json:"checksum"`
+		Payload  json.RawMessage `json:"payload"`
+	}
+
+	cacheStateDef struct {
+		tagMismatch struct {
+			expected string
+			got      string
+			at       time.Time
+		}
+
+		backendError struct {
+			message string
+			at      time.Time
+		}
+
+		// snapshot is the state of the last completed run (see SaveCacheTo and SetCacheSnapshot)
+		snapshot     *CollectorData
+		snapshotLock sync.Mutex
+
+		// standalone is set if the collector is only used for reading the cache (see ReadCache), collector metrics are not updated
+		standalone bool
 	}
 )
 
 const (
 	cacheProtocolFile   = "file"
 	cacheProtocolAzBlob = "azblob"
+
+	cacheAzBlobAuthSharedKey = "sharedkey"
+
+	// cacheLeaseDuration is the lease duration (seconds) of the cache blob for exclusive writes
+	cacheLeaseDuration = int32(60)
+
+	// cacheLeaseReleaseTimeout is the timeout for releasing the lease of the cache blob
+	cacheLeaseReleaseTimeout = 10 * time.Second
+
+	// cacheBlobTierCold is the cold access tier (no constant available in azblob package)
+	cacheBlobTierCold = blob.AccessTier("Cold")
+
+	// EnvCacheStorageKey is the env var for the storage account key for azblob caches with shared key authentication (auth=sharedkey)
+	EnvCacheStorageKey = "AZURE_STORAGE_KEY"
+)
+
+const (
+	// CacheModeDefault restores metrics from cache if available, otherwise metrics are collected
+	CacheModeDefault CacheMode = "default"
+
+	// CacheModeReplay only restores metrics from (tag matching) cache and never collects metrics,
+	// expiry and min remaining time of the cache are ignored as there is no collect run which could refresh it
+	CacheModeReplay CacheMode = "replay"
+)
+
+type (
+	CacheMode string
+)
+
+var (
+	errCacheWriteSkipped = errors.New(`cache write skipped, cache is written by another writer`)
+
+	// cacheLeaseRenewInterval is the interval for renewing the lease of the cache blob during writes
+	cacheLeaseRenewInterval = time.Duration(cacheLeaseDuration) * time.Second / 2
+
+	// cacheBlobTiers are the access tiers of block blobs which can be used for the cache (see SetCacheBlobTier)
+	cacheBlobTiers = []blob.AccessTier{blob.AccessTierHot, blob.AccessTierCool, cacheBlobTierCold}
+
+	cacheSpecTemplateRegexp = regexp.MustCompile(`\{[a-zA-Z0-9_]+\}`)
+	cacheMetadataKeyRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 )
 
 // BuildCacheTag builds a cache tag based on prefix string and various interfaces, returns a tag value (string)
@@ -66,16 +215,288 @@ func (c *Collector) EnableCache(cache string, cacheTag *string) {
 //	  cache can be specified as local file or storageaccount blob:
 //	    path or file://path/to/file will store cached metrics in file
 //		   azblob://storageaccount.blob.core.windows.net/container/blob will store cached metrics in storageaccount
+//		   azblob://storageaccount.blob.core.windows.net/container/blob?readhost=replica.blob.core.windows.net will read cached metrics from replica
+//		   azblob://storageaccount.blob.core.windows.net/container/blob?auth=sharedkey will use storage account key from env var AZURE_STORAGE_KEY
 //		 cacheTag is used to force restore, if nil cacheTag is ignored and otherwise enforced
+//	  placeholders {collector}, {cloud} and custom ones (see SetCacheTemplateVar) are replaced in cache spec
 func (c *Collector) SetCache(cache *string, cacheTag *string) {
+	if err := c.TrySetCache(cache, cacheTag); err != nil {
+		c.logger.Panic(err)
+	}
+}
+
+// TrySetCache enables caching of collector (see SetCache) but returns an error instead of panicking,
+// caching stays disabled if an error occurs (eg. missing Azure environment for azblob caches)
+func (c *Collector) TrySetCache(cache *string, cacheTag *string) error {
 	if cache == nil {
 		c.cache = nil
-		return
+		return nil
+	}
+
+	rawSpec, err := c.renderCacheSpec(*cache)
+	if err != nil {
+		return err
+	}
+
+	cacheSpec, err := parseCacheSpec(rawSpec, cacheTag)
+	if err != nil {
+		return err
+	}
+
+	previousCache := c.cache
+	c.cache = cacheSpec
+	if err := c.setupCacheBackend(); err != nil {
+		c.cache = previousCache
+		return fmt.Errorf(`unable to setup %v cache: %w`, cacheSpec.protocol, err)
+	}
+
+	return nil
+}
+
+// ReadCache reads raw cache content (decompressed if needed) from cache spec (see SetCache) without a running collector,
+// metric list shards of sharded caches (see SetCacheSharded) are assembled into a single cache content
+func ReadCache(ctx context.Context, spec string, logger *zap.SugaredLogger) ([]byte, error) {
+	cacheSpec, err := parseCacheSpec(spec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+
+	// collector is only used for the backend helpers, it is never registered and does not update collector metrics
+	c := &Collector{
+		Name:    "cache",
+		context: ctx,
+		cache:   cacheSpec,
+		logger:  logger,
+		clock:   time.Now,
+	}
+	c.cacheState.standalone = true
+
+	if err := c.setupCacheBackend(); err != nil {
+		return nil, err
+	}
+
+	reader, exists := c.cacheReadBackend(ctx)
+	if !exists {
+		if message, _ := c.LastCacheBackendError(); message != "" {
+			return nil, fmt.Errorf(`unable to read cache: %v`, message)
+		}
+		return nil, fmt.Errorf(`cache not found`)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := cacheUnwrapIntegrity(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, isManifest := cacheParseShardManifest(payload); !isManifest {
+		return payload, nil
+	}
+
+	if c.cache.protocol != cacheProtocolAzBlob {
+		return nil, fmt.Errorf(`cache is a shard manifest, metric list shards are only supported for azblob caches`)
+	}
+
+	assembled, err := c.cacheReadSharded(ctx, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(assembled)
+}
+
+// setupCacheBackend creates clients for cache backend (eg. azblob)
+func (c *Collector) setupCacheBackend() error {
+	if c.cache.protocol == cacheProtocolAzBlob {
+		var newClient func(host string) (*azblob.Client, error)
+
+		if c.cache.spec["azblob:auth"] == cacheAzBlobAuthSharedKey {
+			// storage account key authentication (eg. storage accounts with disabled AzureAD authentication)
+			accountKey := os.Getenv(EnvCacheStorageKey)
+			if accountKey == "" {
+				return fmt.Errorf(`azblob cache with shared key authentication needs storage account key in env var "%v"`, EnvCacheStorageKey)
+			}
+
+			// the key is only valid for one storage account (and its secondary endpoint)
+			if readHost, exists := c.cache.spec["azblob:readhost"]; exists && cacheAzBlobAccountName(readHost) != cacheAzBlobAccountName(c.cache.url.Hostname()) {
+				return fmt.Errorf(`azblob cache with shared key authentication only supports readhost of the same storage account (eg. secondary endpoint), got "%v"`, readHost)
+			}
+
+			// transport settings (eg. TLS configuration) of the cache ArmClient also apply to shared key authentication
+			var azblobOpts *azblob.ClientOptions
+			if c.cacheConfig.armClient != nil {
+				azblobOpts = &azblob.ClientOptions{ClientOptions: *c.cacheConfig.armClient.NewAzCoreClientOptions()}
+			}
+
+			newClient = func(host string) (*azblob.Client, error) {
+				return newCacheAzBlobSharedKeyClient(host, accountKey, azblobOpts)
+			}
+		} else {
+			azureClient := c.cacheConfig.armClient
+			if azureClient == nil {
+				// create client without NewArmClientFromEnvironment as it panics on missing or invalid Azure environment
+				azureEnvironment := os.Getenv(azidentity.EnvAzureEnvironment)
+				if azureEnvironment == "" {
+					return fmt.Errorf(`env var %v is not set`, azidentity.EnvAzureEnvironment)
+				}
+
+				cloudConfig, err := cloudconfig.NewCloudConfig(azureEnvironment)
+				if err != nil {
+					return err
+				}
+				azureClient = armclient.NewArmClient(cloudConfig, c.logger)
+			}
+
+			// cache storage account might be located in another tenant than the discovered subscriptions
+			cred := c.cacheConfig.credential
+			if cred == nil {
+				cred = azureClient.GetCred()
+			}
+			if c.cacheConfig.tenantID != "" {
+				cred = &cacheTenantCredential{cred: cred, tenantID: c.cacheConfig.tenantID}
+			}
+			c.cache.credential = cred
+
+			newClient = func(host string) (*azblob.Client, error) {
+				return newCacheAzBlobClient(azureClient, cred, host)
+			}
+		}
+
+		// create a client for the specified storage account
+		client, err := newClient(c.cache.url.Hostname())
+		if err != nil {
+			return err
+		}
+		c.cache.client = client
+		c.cache.readClient = client
+
+		// create a client for read replica (eg. nearby storage account)
+		if readHost, exists := c.cache.spec["azblob:readhost"]; exists {
+			readClient, err := newClient(readHost)
+			if err != nil {
+				return err
+			}
+			c.cache.readClient = readClient
+		}
+	}
+
+	return nil
+}
+
+// newCacheAzBlobSharedKeyClient creates azblob client for storage account host using storage account key (opts can be nil)
+func newCacheAzBlobSharedKeyClient(host, accountKey string, opts *azblob.ClientOptions) (*azblob.Client, error) {
+	cred, err := azblob.NewSharedKeyCredential(cacheAzBlobAccountName(host), accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return azblob.NewClientWithSharedKeyCredential(fmt.Sprintf(`https://%v/`, host), cred, opts)
+}
+
+// cacheAzBlobAccountName returns storage account name of host, secondary endpoints (account-secondary) return the primary account
+func cacheAzBlobAccountName(host string) string {
+	return strings.TrimSuffix(strings.SplitN(host, ".", 2)[0], "-secondary")
+}
+
+// newCacheAzBlobClient creates azblob client for storage account host using token scope of the selected Azure cloud
+func newCacheAzBlobClient(azureClient *armclient.ArmClient, cred azcore.TokenCredential, host string) (*azblob.Client, error) {
+	azblobOpts := azblob.ClientOptions{ClientOptions: *azureClient.NewAzCoreClientOptions()}
+	azblobOpts.PerRetryPolicies = append(
+		azblobOpts.PerRetryPolicies,
+		runtime.NewBearerTokenPolicy(cred, []string{cacheStorageTokenScope(azureClient.GetCloudConfig(), host)}, nil),
+	)
+
+	return azblob.NewClientWithNoCredential(fmt.Sprintf(`https://%v/`, host), &azblobOpts)
+}
+
+// cacheStorageTokenScope returns token scope for storage account from cloud config
+// (falls back to storage account audience if cloud has no storage configuration, eg. AzurePrivateCloud)
+func cacheStorageTokenScope(cloudConfig cloud.Configuration, host string) string {
+	if serviceConfig, exists := cloudConfig.Services[cloudconfig.ServiceNameStorage]; exists && serviceConfig.Audience != "" {
+		return strings.TrimSuffix(serviceConfig.Audience, "/") + "/.default"
+	}
+
+	return fmt.Sprintf(`https://%v/.default`, host)
+}
+
+// SetCacheFromEnv enables caching of collector from env vars <PREFIX>_CACHE (see SetCache) and <PREFIX>_CACHE_TAG
+//
+//	caching is not changed if <PREFIX>_CACHE is empty
+func (c *Collector) SetCacheFromEnv(prefix string) error {
+	envName := "CACHE"
+	if prefix != "" {
+		envName = strings.ToUpper(strings.TrimSuffix(prefix, "_")) + "_" + envName
+	}
+
+	rawSpec := os.Getenv(envName)
+	if rawSpec == "" {
+		return nil
+	}
+
+	var cacheTag *string
+	if val := os.Getenv(envName + "_TAG"); val != "" {
+		cacheTag = &val
+	}
+
+	if err := c.TrySetCache(&rawSpec, cacheTag); err != nil {
+		return fmt.Errorf(`invalid cache spec in env var "%s": %w`, envName, err)
+	}
+
+	return nil
+}
+
+// SetCacheTemplateVar sets value for placeholder {name} in cache spec (eg. {subscription}), needs to be set before SetCache
+func (c *Collector) SetCacheTemplateVar(name, value string) {
+	if c.cacheConfig.templateVars == nil {
+		c.cacheConfig.templateVars = map[string]string{}
+	}
+	c.cacheConfig.templateVars[name] = value
+}
+
+// renderCacheSpec replaces placeholders ({collector}, {cloud} and custom template vars) in cache spec,
+// {cloud} defaults to AzurePublicCloud if AZURE_ENVIRONMENT is not set
+func (c *Collector) renderCacheSpec(rawSpec string) (string, error) {
+	vars := map[string]string{
+		"collector": c.Name,
+		"cloud":     os.Getenv(azidentity.EnvAzureEnvironment),
 	}
+	if vars["cloud"] == "" {
+		vars["cloud"] = string(cloudconfig.AzurePublicCloud)
+	}
+	for name, value := range c.cacheConfig.templateVars {
+		vars[name] = value
+	}
+
+	var err error
+	ret := cacheSpecTemplateRegexp.ReplaceAllStringFunc(rawSpec, func(placeholder string) string {
+		name := strings.Trim(placeholder, "{}")
+		if value := vars[name]; value != "" {
+			return value
+		}
 
-	rawSpec := *cache
+		err = fmt.Errorf(`cache spec placeholder "%v" has no value`, placeholder)
+		return placeholder
+	})
+
+	return ret, err
+}
+
+// parseCacheSpec parses cache spec (without creating any clients)
+func parseCacheSpec(rawSpec string, cacheTag *string) (*cacheSpecDef, error) {
+	if rawSpec == "" {
+		return nil, fmt.Errorf(`cache spec is empty`)
+	}
 
-	c.cache = &cacheSpecDef{
+	cacheSpec := &cacheSpecDef{
 		raw:  rawSpec,
 		spec: map[string]string{},
 		tag:  cacheTag,
@@ -83,191 +504,1220 @@ func (c *Collector) SetCache(cache *string, cacheTag *string) {
 
 	switch {
 	case strings.HasPrefix(rawSpec, `file://`):
-		c.cache.protocol = cacheProtocolFile
-		c.cache.spec["file:path"] = strings.TrimPrefix(rawSpec, "file://")
+		cacheSpec.protocol = cacheProtocolFile
+		cacheSpec.spec["file:path"] = strings.TrimPrefix(rawSpec, "file://")
 	case strings.HasPrefix(rawSpec, `azblob://`):
-		c.cache.protocol = cacheProtocolAzBlob
+		cacheSpec.protocol = cacheProtocolAzBlob
 		parsedUrl, err := url.Parse(rawSpec)
 		if err != nil {
-			c.logger.Panic(err)
+			return nil, err
 		}
-		c.cache.url = parsedUrl
+		cacheSpec.url = parsedUrl
 
-		azureClient, err := armclient.NewArmClientFromEnvironment(c.logger)
-		if err != nil {
-			c.logger.Panic(err)
-		}
-
-		storageAccount := fmt.Sprintf(`https://%v/`, c.cache.url.Hostname())
-		pathParts := strings.SplitN(c.cache.url.Path, "/", 2)
-		if len(pathParts) < 2 {
-			c.logger.Panicf(`azblob path needs to be specified as azblob://storageaccount.blob.core.windows.net/container/blob, got: %v`, rawSpec)
+		pathParts := strings.SplitN(strings.TrimPrefix(cacheSpec.url.Path, "/"), "/", 2)
+		if len(pathParts) < 2 || pathParts[0] == "" || pathParts[1] == "" {
+			return nil, fmt.Errorf(`azblob path needs to be specified as azblob://storageaccount.blob.core.windows.net/container/blob, got: %v`, rawSpec)
 		}
 
-		c.cache.spec["azblob:container"] = pathParts[0]
-		c.cache.spec["azblob:blob"] = pathParts[1]
+		cacheSpec.spec["azblob:container"] = pathParts[0]
+		cacheSpec.spec["azblob:blob"] = pathParts[1]
 
-		// create a client for the specified storage account
-		azblobOpts := azblob.ClientOptions{ClientOptions: *azureClient.NewAzCoreClientOptions()}
-		client, err := azblob.NewClient(storageAccount, azureClient.GetCred(), &azblobOpts)
-		if err != nil {
-			c.logger.Panic(err)
+		if readHost := cacheSpec.url.Query().Get("readhost"); readHost != "" {
+			cacheSpec.spec["azblob:readhost"] = readHost
 		}
 
-		c.cache.client = client
-
+		if auth := cacheSpec.url.Query().Get("auth"); auth != "" {
+			if auth != cacheAzBlobAuthSharedKey {
+				return nil, fmt.Errorf(`invalid azblob auth "%v", only "%v" is supported`, auth, cacheAzBlobAuthSharedKey)
+			}
+			cacheSpec.spec["azblob:auth"] = auth
+		}
 	default:
-		c.cache.protocol = cacheProtocolFile
-		c.cache.spec["file:path"] = rawSpec
+		cacheSpec.protocol = cacheProtocolFile
+		cacheSpec.spec["file:path"] = rawSpec
 	}
-}
 
-// DisableCache disables all caching
-func (c *Collector) DisableCache() {
-	c.cache = nil
+	return cacheSpec, nil
 }
 
-// collectionRestoreCache tries to restore metrics from cache
-func (c *Collector) collectionRestoreCache() bool {
-	if c.cache == nil {
-		return false
-	}
-
-	if cacheContent, exists := c.cacheRead(); exists {
-		restoredData := NewCollectorData()
+// ParseCacheSpec parses and validates cache spec (see SetCache) without setting up the cache backend (eg. for config validation)
+//
+//	placeholders (see SetCacheTemplateVar) are not rendered, they are validated with dummy values and kept as they are
+func ParseCacheSpec(rawSpec string) (*CacheSpec, error) {
+	// replace placeholders with dummy values as placeholders are not valid in urls (eg. in hostname)
+	var placeholders []string
+	dummySpec := cacheSpecTemplateRegexp.ReplaceAllStringFunc(rawSpec, func(placeholder string) string {
+		dummy := fmt.Sprintf("cachespec%dplaceholder", len(placeholders)/2)
+		placeholders = append(placeholders, dummy, placeholder)
+		return dummy
+	})
 
-		c.logger.Infof(`restoring state from cache: %s`, c.cache.raw)
+	cacheSpec, err := parseCacheSpec(dummySpec, nil)
+	if err != nil {
+		return nil, err
+	}
 
-		err := json.Unmarshal(cacheContent, &restoredData)
-		if err == nil {
-			if c.cache.tag != nil {
-				if restoredData.Tag == nil || to.String(c.cache.tag) != to.String(restoredData.Tag) {
-					// cache tag check is enforced but there is a mismatch
-					c.logger.Infof(`cache tag mismatch, ignoring cache`)
-					return false
-				}
-			}
+	placeholderReplacer := strings.NewReplacer(placeholders...)
 
-			if restoredData.Expiry != nil && restoredData.Expiry.After(time.Now()) {
-				// restore data
-				c.data.Expiry = restoredData.Expiry
-				for name, restoreMetricList := range restoredData.Metrics {
-					if restoreMetricList.List == nil {
-						continue
-					}
-
-					if metricList, exists := c.data.Metrics[name]; exists {
-						metricList.List = restoreMetricList.List
-						metricList.Init()
-					}
-				}
+	spec := &CacheSpec{
+		Protocol: cacheSpec.protocol,
+	}
 
-				// calculate sleep time for next collect run
-				// but sleep time should not exceed defined scrape time
-				sleepTime := time.Until(*c.data.Expiry) + 1*time.Minute
-				if c.scrapeTime != nil && sleepTime < *c.scrapeTime {
-					c.SetNextSleepDuration(sleepTime)
-				}
+	switch cacheSpec.protocol {
+	case cacheProtocolFile:
+		spec.Path = placeholderReplacer.Replace(cacheSpec.spec["file:path"])
+	case cacheProtocolAzBlob:
+		spec.Host = placeholderReplacer.Replace(cacheSpec.url.Hostname())
+		spec.Container = placeholderReplacer.Replace(cacheSpec.spec["azblob:container"])
+		spec.Blob = placeholderReplacer.Replace(cacheSpec.spec["azblob:blob"])
+		spec.ReadHost = placeholderReplacer.Replace(cacheSpec.spec["azblob:readhost"])
+		spec.Auth = cacheSpec.spec["azblob:auth"]
+	}
 
-				// restore last scrape time from cache
-				if restoredData.Created != nil {
-					c.lastScrapeTime = restoredData.Created
-				}
+	return spec, nil
+}
 
-				c.logger.Infof(`restored state from cache: "%s" (expiring %s)`, c.cache.raw, c.data.Expiry.UTC().String())
-				return true
-			} else {
-				c.logger.Infof(`ignoring cached state, already expired`)
-			}
-		} else {
-			c.logger.Warnf(`unable to decode cache: %v`, err.Error())
+// SetCacheBlobTier sets the access tier (Hot, Cool or Cold) used for azblob cache writes
+//
+//	Archive is not supported as the cache would not be readable without rehydration,
+//	premium tiers (eg. P10) are only available for page blobs
+func (c *Collector) SetCacheBlobTier(tier string) error {
+	for _, accessTier := range cacheBlobTiers {
+		if strings.EqualFold(string(accessTier), tier) {
+			accessTier := accessTier
+			c.cacheConfig.blobTier = &accessTier
+			return nil
 		}
 	}
 
-	return false
+	return fmt.Errorf(`invalid azblob access tier "%v", supported tiers are Hot, Cool and Cold`, tier)
+}
+
+// SetCacheMinRemaining sets the minimum remaining validity of a cache, caches expiring earlier are ignored and a fresh scrape is triggered
+func (c *Collector) SetCacheMinRemaining(minRemaining time.Duration) {
+	c.cacheConfig.minRemaining = minRemaining
+}
+
+// SetCacheCompactOnStart enables removal of expired cache files/blobs on collector start (see CompactCache)
+func (c *Collector) SetCacheCompactOnStart(val bool) {
+	c.cacheConfig.compactOnStart = val
 }
 
-// collectionSaveCache saves current metrics to cache
-func (c *Collector) collectionSaveCache() {
+// CompactCache removes cache files/blobs from cache directory/container (same path prefix as the cache) which are expired
+// for longer than olderThan (0 removes all expired caches), returns count of removed files/blobs
+//
+//	files/blobs which cannot be parsed as cache are kept
+func (c *Collector) CompactCache(ctx context.Context, olderThan time.Duration) (int, error) {
 	if c.cache == nil {
-		return
+		return 0, nil
 	}
 
-	expiryTime := time.Now().Add(*c.sleepTime)
-	c.data.Created = &c.collectionStartTime
-	c.data.Expiry = &expiryTime
-	c.data.Tag = c.cache.tag
+	threshold := c.clock().Add(-olderThan)
 
-	if jsonData, err := json.Marshal(c.data); err == nil {
-		c.cacheStore(jsonData)
-		c.logger.Infof(`saved state to cache: %s (expiring %s)`, c.cache.raw, c.data.Expiry.UTC().String())
-	} else {
-		c.logger.Errorf(`failed to serialize state for cache: %v`, err.Error())
+	switch c.cache.protocol {
+	case cacheProtocolFile:
+		return c.compactCacheFile(threshold)
+	case cacheProtocolAzBlob:
+		return c.compactCacheAzBlob(ctx, threshold)
 	}
 
+	return 0, fmt.Errorf(`cache compaction is not supported for cache protocol "%v"`, c.cache.protocol)
 }
 
-// cacheRead reads content from cache
-func (c *Collector) cacheRead() ([]byte, bool) {
-	switch c.cache.protocol {
-	case cacheProtocolFile:
-		filePath := c.cache.spec["file:path"]
-		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
-			content, _ := os.ReadFile(filePath) // #nosec inside container
-			return content, true
+// compactCacheFile removes cache files (next to the cache file, see isCacheCompactionCandidate) which expired before threshold
+func (c *Collector) compactCacheFile(threshold time.Time) (int, error) {
+	cacheFile := filepath.Base(c.cache.spec["file:path"])
+	dirPath := filepath.Dir(c.cache.spec["file:path"])
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		// skip directories and temporary files (could be written right now)
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
 		}
-	case cacheProtocolAzBlob:
-		response, err := c.cache.client.(*azblob.Client).DownloadStream(c.context, c.cache.spec["azblob:container"], c.cache.spec["azblob:blob"], nil)
-		if err == nil {
-			if content, err := io.ReadAll(response.Body); err == nil {
-				return content, true
+
+		// only read files matching the cache file name pattern
+		if !isCacheCompactionCandidate(cacheFile, entry.Name()) {
+			continue
+		}
+
+		filePath := filepath.Join(dirPath, entry.Name())
+		content, err := os.ReadFile(filePath) // #nosec inside container
+		if err != nil {
+			continue
+		}
+
+		if expiry := c.cacheContentExpiry(content); expiry != nil && expiry.Before(threshold) {
+			if err := os.Remove(filePath); err != nil {
+				return removed, err
 			}
+			c.cacheLogger().Debugf(`removed expired cache file "%v"`, filePath)
+			removed++
 		}
 	}
 
-	return nil, false
+	return removed, nil
 }
 
-// cacheRead saves content to cache
-func (c *Collector) cacheStore(content []byte) {
-	switch c.cache.protocol {
-	case cacheProtocolFile:
-		filePath := c.cache.spec["file:path"]
+// compactCacheAzBlob removes cache blobs (next to the cache blob, see isCacheCompactionCandidate) which expired before threshold
+func (c *Collector) compactCacheAzBlob(ctx context.Context, threshold time.Time) (int, error) {
+	ctx, cancel := c.cacheContext(ctx, c.cacheConfig.writeTimeout)
+	defer cancel()
 
-		dirPath := filepath.Dir(filePath)
+	client := c.cache.client.(*azblob.Client)
+	container := c.cache.spec["azblob:container"]
 
-		// ensure directory
-		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-			err := os.Mkdir(dirPath, 0700)
+	prefix := ""
+	if dirPath := path.Dir(c.cache.spec["azblob:blob"]); dirPath != "." {
+		prefix = dirPath + "/"
+	}
+
+	removed := 0
+	pager := client.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return removed, err
+		}
+
+		if result.Segment == nil {
+			continue
+		}
+
+		for _, item := range result.Segment.BlobItems {
+			// only download blobs which might be caches, container might contain other data (or the whole container is listed)
+			if item.Name == nil || !isCacheCompactionCandidate(c.cache.spec["azblob:blob"], *item.Name) {
+				continue
+			}
+
+			// blobs are modified before they expire, so recently modified blobs cannot be expired before threshold
+			if item.Properties != nil && item.Properties.LastModified != nil && item.Properties.LastModified.After(threshold) {
+				continue
+			}
+
+			content, err := c.cacheDownloadBlob(ctx, client, container, *item.Name)
 			if err != nil {
-				c.logger.Panic(err)
+				continue
 			}
-		}
 
-		// calc tmp filename
-		tmpFilePath := filepath.Join(
-			dirPath,
-			fmt.Sprintf(
-				".%s.tmp",
-				filepath.Base(filePath),
-			),
-		)
+			if expiry := c.cacheContentExpiry(content); expiry != nil && expiry.Before(threshold) {
+				if _, err := client.DeleteBlob(ctx, container, *item.Name, nil); err != nil {
+					return removed, err
+				}
+				c.cacheLogger().Debugf(`removed expired cache blob "%v"`, *item.Name)
+				removed++
 
-		// write to temp file first
-		err := os.WriteFile(tmpFilePath, content, 0600) // #nosec inside container
-		if err != nil {
-			c.logger.Panic(err)
+				// metric list shards of expired cache (see SetCacheSharded)
+				if _, err := c.cacheDeleteShards(ctx, *item.Name); err != nil {
+					return removed, err
+				}
+			}
 		}
+	}
 
-		// rename file to final cache file (atomic operation)
-		err = os.Rename(tmpFilePath, filePath)
+	return removed, nil
+}
+
+// isCacheCompactionCandidate checks if file/blob name matches the cache name pattern (same directory and file extension as cache),
+// so metric list shards, write test blobs and other files/blobs are skipped
+func isCacheCompactionCandidate(cacheName, name string) bool {
+	return path.Dir(name) == path.Dir(cacheName) && path.Ext(name) == path.Ext(cacheName)
+}
+
+// cacheDownloadBlob downloads (and decompresses if needed) blob from container
+func (c *Collector) cacheDownloadBlob(ctx context.Context, client *azblob.Client, container, blobName string) ([]byte, error) {
+	response, err := client.DownloadStream(ctx, container, blobName, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var reader io.Reader = response.Body
+	if strings.EqualFold(to.String(response.ContentEncoding), "gzip") {
+		gzipReader, err := gzip.NewReader(response.Body)
 		if err != nil {
-			c.logger.Panic(err)
+			return nil, err
 		}
-	case cacheProtocolAzBlob:
-		_, err := c.cache.client.(*azblob.Client).UploadBuffer(c.context, c.cache.spec["azblob:container"], c.cache.spec["azblob:blob"], content, nil)
-		if err != nil {
-			c.logger.Panic(err)
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	return io.ReadAll(reader)
+}
+
+// cacheContentExpiry returns expiry of cache content (nil if content is not a cache)
+func (c *Collector) cacheContentExpiry(content []byte) *time.Time {
+	if c.cacheConfig.integrityCheck {
+		var err error
+		if content, err = cacheVerifyIntegrity(content); err != nil {
+			return nil
 		}
 	}
+
+	cacheData := struct {
+		Expiry *time.Time `json:"expiry"`
+	}{}
+	if err := json.Unmarshal(content, &cacheData); err != nil {
+		return nil
+	}
+
+	return cacheData.Expiry
+}
+
+// LastCacheTagMismatch returns expected and stored cache tag of the last cache tag mismatch (time is zero if no mismatch occurred)
+func (c *Collector) LastCacheTagMismatch() (expected, got string, at time.Time) {
+	return c.cacheState.tagMismatch.expected, c.cacheState.tagMismatch.got, c.cacheState.tagMismatch.at
+}
+
+// LastCacheBackendError returns last error message of the cache backend read/store (message is empty if no error occurred)
+func (c *Collector) LastCacheBackendError() (message string, at time.Time) {
+	return c.cacheState.backendError.message, c.cacheState.backendError.at
+}
+
+// SetCacheStreamThreshold sets blob size (bytes) from which cache is downloaded into a temp file and decoded from disk
+// instead of reading it into memory (only remote backends eg. azblob, 0 disables streaming)
+func (c *Collector) SetCacheStreamThreshold(size int64) {
+	c.cacheConfig.streamSize = size
+}
+
+// SetCacheAcceptPreviousTag sets previous cache tags which are also accepted when restoring the cache
+//
+//	restored metrics are served until the next (immediately started) collect run has finished,
+//	in replay mode the next run is scheduled as usual as metrics are never collected
+func (c *Collector) SetCacheAcceptPreviousTag(tags ...string) {
+	c.cacheConfig.previousTags = tags
+}
+
+// isCachePreviousTag checks if tag is an accepted previous cache tag
+func (c *Collector) isCachePreviousTag(tag string) bool {
+	for _, previousTag := range c.cacheConfig.previousTags {
+		if previousTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCacheMode sets cache mode (see CacheModeDefault and CacheModeReplay)
+func (c *Collector) SetCacheMode(mode CacheMode) {
+	c.cacheConfig.mode = mode
+}
+
+// SetCacheExpiryJitter sets maximum random jitter added to the cache expiry (0 disables jitter)
+//
+//	the jitter is also added to the sleep time after a cache restore (random per collector),
+//	so replicas restoring the same cache do not rescrape at the same time
+func (c *Collector) SetCacheExpiryJitter(jitter time.Duration) {
+	c.cacheConfig.expiryJitter = jitter
+}
+
+// SetCacheReadTimeout sets timeout for cache read operations (only remote backends eg. azblob, 0 disables timeout)
+func (c *Collector) SetCacheReadTimeout(timeout time.Duration) {
+	c.cacheConfig.readTimeout = timeout
+}
+
+// SetCacheWriteTimeout sets timeout for cache write operations (only remote backends eg. azblob, 0 disables timeout)
+func (c *Collector) SetCacheWriteTimeout(timeout time.Duration) {
+	c.cacheConfig.writeTimeout = timeout
+}
+
+// SetCacheSnapshot enables keeping the state of the last completed run in memory for SaveCacheTo
+//
+//	metric rows of the last run are kept until the next run completes, disabled by default
+func (c *Collector) SetCacheSnapshot(val bool) {
+	c.cacheConfig.snapshot = val
+}
+
+// SetCacheIntegrityCheck enables storing and verifying a sha256 checksum of the cache content, mismatches are treated as cache miss
+func (c *Collector) SetCacheIntegrityCheck(val bool) {
+	c.cacheConfig.integrityCheck = val
+}
+
+// SetCacheReadOnly disables writing (and compaction) of the cache, cache is still restored
+func (c *Collector) SetCacheReadOnly(val bool) {
+	c.cacheConfig.readOnly = val
+}
+
+// SetCacheBlobUploadOptions sets block size (bytes) and concurrency of azblob cache uploads (0 uses azblob defaults)
+func (c *Collector) SetCacheBlobUploadOptions(blockSize int64, concurrency int) error {
+	if blockSize < 0 || blockSize > blockblob.MaxStageBlockBytes {
+		return fmt.Errorf(`invalid azblob upload block size %v, needs to be between 0 and %v bytes`, blockSize, int64(blockblob.MaxStageBlockBytes))
+	}
+
+	if concurrency < 0 || concurrency > math.MaxUint16 {
+		return fmt.Errorf(`invalid azblob upload concurrency %v, needs to be between 0 and %v`, concurrency, math.MaxUint16)
+	}
+
+	c.cacheConfig.uploadOptions.blockSize = blockSize
+	c.cacheConfig.uploadOptions.concurrency = uint16(concurrency)
+	return nil
+}
+
+// SetCacheCredential sets the credential for azblob caches (eg. for a storage account in another tenant),
+// the Azure credential from environment is used if not set, needs to be set before SetCache
+//
+//	takes precedence over storage account key from env var AZURE_STORAGE_KEY (unless auth=sharedkey is set in cache spec)
+func (c *Collector) SetCacheCredential(cred azcore.TokenCredential) {
+	c.cacheConfig.credential = cred
+}
+
+// SetCacheArmClient sets the ArmClient used for azblob caches (cloud configuration, credential and transport settings
+// eg. SetTLSConfig or SetHTTPClient), an ArmClient from environment is used if not set, needs to be set before SetCache
+//
+//	transport settings also apply to caches with shared key authentication (auth=sharedkey),
+//	credential set by SetCacheCredential takes precedence over the credential of the ArmClient
+func (c *Collector) SetCacheArmClient(azureClient *armclient.ArmClient) {
+	c.cacheConfig.armClient = azureClient
+}
+
+// SetCacheTenant sets the Azure AD tenant for azblob cache tokens (eg. storage account in a dedicated tenant),
+// needs to be set before SetCache
+//
+//	the credential needs to be allowed to request tokens for this tenant
+//	(eg. env var AZURE_ADDITIONALLY_ALLOWED_TENANTS for the default Azure credential)
+func (c *Collector) SetCacheTenant(tenantID string) {
+	c.cacheConfig.tenantID = tenantID
+}
+
+// GetToken requests token of the wrapped credential for the cache tenant
+func (cred *cacheTenantCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	opts.TenantID = cred.tenantID
+	return cred.cred.GetToken(ctx, opts)
+}
+
+// SetCacheExclusiveWrite enables exclusive cache writes using a blob lease (only azblob),
+// the write is skipped if the cache blob is leased by another writer (eg. other replica)
+//
+//	lease duration is 60 seconds and the lease is renewed during the upload, the first write only creates the
+//	cache blob if it does not exist yet (no lease is possible for missing blobs)
+func (c *Collector) SetCacheExclusiveWrite(val bool) {
+	c.cacheConfig.exclusiveWrite = val
+}
+
+// SetCacheMetadata sets additional metadata for cache blobs (only azblob), keys need to be valid C# identifiers
+//
+//	collector, hostname and tag are added automatically
+func (c *Collector) SetCacheMetadata(metadata map[string]string) error {
+	for key := range metadata {
+		if !cacheMetadataKeyRegexp.MatchString(key) {
+			return fmt.Errorf(`invalid cache metadata key "%v", needs to match %v`, key, cacheMetadataKeyRegexp.String())
+		}
+	}
+
+	c.cacheConfig.metadata = metadata
+	return nil
+}
+
+// cacheBlobMetadata returns metadata for cache blob (configured and automatic metadata)
+func (c *Collector) cacheBlobMetadata() map[string]*string {
+	metadata := map[string]*string{}
+	for key, value := range c.cacheConfig.metadata {
+		metadata[key] = to.StringPtr(value)
+	}
+
+	metadata["collector"] = to.StringPtr(c.Name)
+	if hostname, err := os.Hostname(); err == nil {
+		metadata["hostname"] = to.StringPtr(hostname)
+	}
+	if cacheTag := c.cacheTag(); cacheTag != nil {
+		metadata["tag"] = to.StringPtr(*cacheTag)
+	}
+
+	return metadata
+}
+
+// CacheBackendInfo returns information about the configured cache backend and verifies that the azblob container exists
+func (c *Collector) CacheBackendInfo() (map[string]string, error) {
+	if c.cache == nil {
+		return nil, fmt.Errorf(`cache is not enabled`)
+	}
+
+	info := map[string]string{
+		"protocol": c.cache.protocol,
+		"url":      c.cache.redactedUrl(),
+	}
+
+	switch c.cache.protocol {
+	case cacheProtocolFile:
+		info["path"] = c.cache.spec["file:path"]
+	case cacheProtocolAzBlob:
+		info["host"] = c.cache.url.Hostname()
+		info["container"] = c.cache.spec["azblob:container"]
+		info["blob"] = c.cache.spec["azblob:blob"]
+
+		ctx, cancel := c.cacheContext(c.context, c.cacheConfig.readTimeout)
+		defer cancel()
+
+		containerClient := c.cache.client.(*azblob.Client).ServiceClient().NewContainerClient(c.cache.spec["azblob:container"])
+		if _, err := containerClient.GetProperties(ctx, nil); err != nil {
+			if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+				return info, fmt.Errorf(`azblob container "%v" not found in storage account "%v"`, c.cache.spec["azblob:container"], c.cache.url.Hostname())
+			}
+			return info, fmt.Errorf(`unable to access azblob container "%v" in storage account "%v": %w`, c.cache.spec["azblob:container"], c.cache.url.Hostname(), err)
+		}
+	}
+
+	return info, nil
+}
+
+// SetCacheVerifyWritable enables verification of cache write permissions on collector start (see VerifyCacheWritable)
+func (c *Collector) SetCacheVerifyWritable(val bool) {
+	c.cacheConfig.verifyWritable = val
+}
+
+// VerifyCacheWritable verifies that the cache can be written by writing (and removing) a small test file/blob
+func (c *Collector) VerifyCacheWritable(ctx context.Context) error {
+	if c.cache == nil {
+		return fmt.Errorf(`cache is not enabled`)
+	}
+
+	switch c.cache.protocol {
+	case cacheProtocolFile:
+		dirPath := filepath.Dir(c.cache.spec["file:path"])
+		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+			if err := os.Mkdir(dirPath, 0700); err != nil {
+				return fmt.Errorf(`unable to create cache directory "%v": %w`, dirPath, err)
+			}
+		}
+
+		testFile, err := os.CreateTemp(dirPath, ".writetest-*")
+		if err != nil {
+			return fmt.Errorf(`cache directory "%v" is not writable: %w`, dirPath, err)
+		}
+		if err := testFile.Close(); err != nil {
+			return fmt.Errorf(`cache directory "%v" is not writable: %w`, dirPath, err)
+		}
+		if err := os.Remove(testFile.Name()); err != nil {
+			return fmt.Errorf(`unable to remove cache test file "%v": %w`, testFile.Name(), err)
+		}
+	case cacheProtocolAzBlob:
+		ctx, cancel := c.cacheContext(ctx, c.cacheConfig.writeTimeout)
+		defer cancel()
+
+		// unique test blob per check, replicas sharing the cache verify concurrently on startup
+		container := c.cache.spec["azblob:container"]
+		testBlob := fmt.Sprintf(`%v.writetest-%x`, c.cache.spec["azblob:blob"], rand.Int63()) // #nosec:G404 random value only used for test blob name
+		client := c.cache.client.(*azblob.Client)
+
+		if _, err := client.UploadBuffer(ctx, container, testBlob, []byte(`{}`), nil); err != nil {
+			if bloberror.HasCode(err, bloberror.AuthorizationPermissionMismatch, bloberror.AuthorizationFailure, bloberror.InsufficientAccountPermissions) {
+				return fmt.Errorf(`missing write permission for azblob container "%v" in storage account "%v" (eg. role "Storage Blob Data Contributor"): %w`, container, c.cache.url.Hostname(), err)
+			}
+			return fmt.Errorf(`unable to write test blob to azblob container "%v" in storage account "%v": %w`, container, c.cache.url.Hostname(), err)
+		}
+
+		if _, err := client.DeleteBlob(ctx, container, testBlob, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf(`unable to remove test blob "%v" from azblob container "%v" in storage account "%v": %w`, testBlob, container, c.cache.url.Hostname(), err)
+		}
+	}
+
+	return nil
+}
+
+// DisableCache disables all caching
+func (c *Collector) DisableCache() {
+	c.cache = nil
+}
+
+// collectionRestoreCache tries to restore metrics from cache
+func (c *Collector) collectionRestoreCache(ctx context.Context) bool {
+	if c.cache == nil {
+		return false
+	}
+
+	logger := c.cacheLogger()
+
+	if cacheContent, exists := c.cacheRead(ctx); exists {
+		defer cacheContent.Close()
+
+		logger.Info(`restoring state from cache`)
+
+		if c.cacheIsSharded() {
+			reader, err := c.cacheReadSharded(ctx, cacheContent)
+			if err != nil {
+				c.countError(errorStageCacheRead)
+				logger.Warnf(`unable to read sharded cache: %v`, err.Error())
+				return false
+			}
+
+			return c.restoreCacheData(reader, logger) == nil
+		}
+
+		return c.restoreCacheData(cacheContent, logger) == nil
+	} else {
+		logger.Info(`no cached state found`)
+	}
+
+	return false
+}
+
+// restoreCacheData decodes cached state from reader and restores it (if tag and expiry are valid)
+//
+//	metric values are float64 and encoding/json writes the shortest representation which parses to the same float64,
+//	so values are restored without loss (integers are exact up to 2^53, as for all prometheus sample values)
+func (c *Collector) restoreCacheData(reader io.Reader, logger *zap.SugaredLogger) error {
+	restoredData := NewCollectorData()
+
+	err := json.NewDecoder(reader).Decode(&restoredData)
+	if err != nil {
+		c.countError(errorStageCacheRead)
+		logger.Warnf(`unable to decode cache: %v`, err.Error())
+		return fmt.Errorf(`unable to decode cache: %w`, err)
+	}
+
+	previousTag := false
+	if cacheTag := c.cacheTag(); cacheTag != nil {
+		if restoredData.Tag != nil && to.String(cacheTag) != to.String(restoredData.Tag) && c.isCachePreviousTag(to.String(restoredData.Tag)) {
+			// cache was written with an accepted previous tag, serve it until fresh collect run finished
+			previousTag = true
+			logger.With(
+				zap.String("cache_tag_expected", to.String(cacheTag)),
+				zap.String("cache_tag_stored", to.String(restoredData.Tag)),
+			).Info(`cache tag mismatch, accepting cache with previous tag`)
+		} else if restoredData.Tag == nil || to.String(cacheTag) != to.String(restoredData.Tag) {
+			// cache tag check is enforced but there is a mismatch
+			c.cacheState.tagMismatch.expected = to.String(cacheTag)
+			c.cacheState.tagMismatch.got = to.String(restoredData.Tag)
+			c.cacheState.tagMismatch.at = c.clock()
+			metricCacheTagMismatch.WithLabelValues(c.Name).Inc()
+
+			logger.With(
+				zap.String("cache_tag_expected", c.cacheState.tagMismatch.expected),
+				zap.String("cache_tag_stored", c.cacheState.tagMismatch.got),
+			).Info(`cache tag mismatch, ignoring cache`)
+			return fmt.Errorf(`cache tag mismatch, expected "%v", got "%v"`, c.cacheState.tagMismatch.expected, c.cacheState.tagMismatch.got)
+		}
+	}
+
+	// replay mode never collects, so cache is restored regardless of its expiry
+	replay := c.cacheConfig.mode == CacheModeReplay
+
+	if !replay && restoredData.Expiry != nil && c.cacheConfig.minRemaining > 0 && restoredData.Expiry.Sub(c.clock()) < c.cacheConfig.minRemaining {
+		// cache is nearly expired, prefer fresh scrape
+		logger.Infof(`ignoring cached state, expiring within %s`, c.cacheConfig.minRemaining.String())
+		return fmt.Errorf(`cached state is expiring within %s`, c.cacheConfig.minRemaining.String())
+	}
+
+	if restoredData.Expiry == nil || (!replay && !restoredData.Expiry.After(c.clock())) {
+		logger.Info(`ignoring cached state, already expired`)
+		return fmt.Errorf(`cached state is already expired`)
+	}
+
+	// restore data
+	c.data.Expiry = restoredData.Expiry
+	for name, restoreMetricList := range restoredData.Metrics {
+		if restoreMetricList.List == nil {
+			continue
+		}
+
+		if metricList, exists := c.data.Metrics[name]; exists {
+			if metricList.ephemeral {
+				// ephemeral metrics are never restored (eg. cache written before metric list was marked ephemeral)
+				continue
+			}
+
+			if !restoreMetricList.Desc.matches(metricList.Desc) {
+				logger.Warnf(`ignoring cached metric "%v", metric descriptor (name, type) does not match registered metric`, name)
+				continue
+			}
+
+			metricList.List = restoreMetricList.List
+			metricList.Init()
+		}
+	}
+
+	// calculate sleep time for next collect run (with random jitter as replicas restoring the same cache would rescrape at the same time)
+	// but sleep time should not exceed defined scrape time (expired caches in replay mode use scrape time)
+	sleepTime := c.data.Expiry.Sub(c.clock()) + 1*time.Minute + c.cacheExpiryJitter()
+	if c.scrapeTime != nil && c.data.Expiry.After(c.clock()) && sleepTime < *c.scrapeTime {
+		c.SetNextSleepDuration(sleepTime)
+	}
+
+	if previousTag && c.cacheConfig.mode != CacheModeReplay {
+		// cache is from previous tag, trigger fresh collect run immediately
+		// (not in replay mode as collect is skipped there and the restore would be repeated without delay)
+		c.SetNextSleepDuration(0)
+	}
+
+	// restore last scrape time from cache
+	if restoredData.Created != nil {
+		c.lastScrapeTime = restoredData.Created
+	}
+
+	c.data.Created = restoredData.Created
+	c.updateCacheMetrics()
+	metricLastCacheRestore.WithLabelValues(c.Name).Set(float64(c.clock().Unix()))
+	if restoredData.Created != nil {
+		metricCacheRestoreAge.WithLabelValues(c.Name).Observe(c.clock().Sub(*restoredData.Created).Seconds())
+	}
+
+	logger.With(zap.Time("expiry", c.data.Expiry.UTC())).Info(`restored state from cache`)
+	return nil
+}
+
+// RestoreCacheFrom restores metrics from cached state in reader (independent of configured cache backend)
+func (c *Collector) RestoreCacheFrom(r io.Reader) error {
+	release, _ := c.acquireRun(context.Background())
+	defer release()
+
+	var err error
+	restored := c.runRestore(func() bool {
+		err = c.restoreCacheData(r, c.logger)
+		return err == nil
+	})
+
+	if err == nil && !restored {
+		err = fmt.Errorf(`unable to apply cached metrics`)
+	}
+
+	return err
+}
+
+// SaveCacheTo writes state of the last completed run (collect or restore) as cache to writer (independent of configured cache backend)
+//
+//	needs enabled cache snapshot (see SetCacheSnapshot)
+func (c *Collector) SaveCacheTo(w io.Writer) error {
+	if !c.cacheConfig.snapshot {
+		return fmt.Errorf(`unable to save cache, cache snapshot is not enabled`)
+	}
+
+	c.cacheState.snapshotLock.Lock()
+	snapshot := c.cacheState.snapshot
+	c.cacheState.snapshotLock.Unlock()
+
+	if snapshot == nil {
+		return fmt.Errorf(`unable to save cache, collector has not collected metrics yet`)
+	}
+
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// cacheTag returns enforced cache tag (nil if cache is not enabled or tag is not set)
+func (c *Collector) cacheTag() *string {
+	if c.cache == nil {
+		return nil
+	}
+	return c.cache.tag
+}
+
+// prepareCacheData sets cache metadata (created, expiry and tag) of current state
+func (c *Collector) prepareCacheData() {
+	// random jitter to avoid synchronized rescrapes of replicas sharing the same cache
+	expiryTime := c.clock().Add(*c.sleepTime + c.cacheExpiryJitter())
+	c.data.Created = &c.collectionStartTime
+	c.data.Expiry = &expiryTime
+	c.data.Tag = c.cacheTag()
+}
+
+// cacheExpiryJitter returns random jitter up to the configured cache expiry jitter (see SetCacheExpiryJitter)
+func (c *Collector) cacheExpiryJitter() time.Duration {
+	if c.cacheConfig.expiryJitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(c.cacheConfig.expiryJitter))) // #nosec:G404 random value only used for cache expiry
+}
+
+// cacheSnapshot returns collector data for cache without ephemeral metric lists
+//
+//	snapshot keeps the rows of the current state as metric lists get new row slices on cleanup (see cleanupMetricLists)
+func (c *Collector) cacheSnapshot() *CollectorData {
+	snapshot := *c.data
+	if c.data.Created != nil {
+		created := *c.data.Created
+		snapshot.Created = &created
+	}
+
+	snapshot.Data = make(map[string]interface{}, len(c.data.Data))
+	for name, val := range c.data.Data {
+		snapshot.Data[name] = val
+	}
+
+	snapshot.Metrics = make(map[string]*MetricList, len(c.data.Metrics))
+	for name, metricList := range c.data.Metrics {
+		if !metricList.ephemeral {
+			list := prometheusCommon.NewMetricsList()
+			list.List = metricList.GetList()
+			snapshot.Metrics[name] = &MetricList{
+				MetricList: list,
+				Desc:       metricList.Desc,
+			}
+		}
+	}
+
+	return &snapshot
+}
+
+// storeCacheSnapshot keeps snapshot of current state for SaveCacheTo (only if enabled, see SetCacheSnapshot)
+func (c *Collector) storeCacheSnapshot() {
+	if !c.cacheConfig.snapshot {
+		return
+	}
+
+	snapshot := c.cacheSnapshot()
+	c.cacheState.snapshotLock.Lock()
+	c.cacheState.snapshot = snapshot
+	c.cacheState.snapshotLock.Unlock()
+}
+
+// collectionSaveCache saves current metrics to cache (metadata needs to be set, see prepareCacheData)
+func (c *Collector) collectionSaveCache(ctx context.Context) {
+	if c.cache == nil {
+		return
+	}
+
+	if c.cacheConfig.readOnly {
+		c.cacheLogger().Debug(`cache is read-only, not saving state to cache`)
+		return
+	}
+
+	if c.cacheIsSharded() {
+		if err := c.cacheStoreSharded(ctx); err == nil {
+			c.updateCacheMetrics()
+			c.cacheLogger().With(zap.Time("expiry", c.data.Expiry.UTC())).Info(`saved state to sharded cache`)
+		} else if errors.Is(err, errCacheWriteSkipped) {
+			c.cacheLogger().Info(`cache blob is leased by another writer, skipping save of state to cache`)
+		} else {
+			c.countError(errorStageCacheWrite)
+			c.cacheLogger().Errorf(`failed to save state to sharded cache: %v`, err.Error())
+		}
+		return
+	}
+
+	if jsonData, err := json.Marshal(c.cacheSnapshot()); err == nil {
+		if err := c.cacheStore(ctx, jsonData); err == nil {
+			c.updateCacheMetrics()
+			c.cacheLogger().With(zap.Time("expiry", c.data.Expiry.UTC())).Info(`saved state to cache`)
+		} else if errors.Is(err, errCacheWriteSkipped) {
+			c.cacheLogger().Info(`cache blob is leased by another writer, skipping save of state to cache`)
+		} else {
+			c.countError(errorStageCacheWrite)
+			c.cacheLogger().Errorf(`failed to save state to cache: %v`, err.Error())
+		}
+	} else {
+		c.countError(errorStageCacheWrite)
+		c.cacheLogger().Errorf(`failed to serialize state for cache: %v`, err.Error())
+	}
+}
+
+// updateCacheMetrics sets cache metadata metrics (created and expiry)
+func (c *Collector) updateCacheMetrics() {
+	if c.data.Created != nil {
+		metricCacheCreated.WithLabelValues(c.Name).Set(float64(c.data.Created.Unix()))
+	}
+
+	if c.data.Expiry != nil {
+		metricCacheExpiry.WithLabelValues(c.Name).Set(float64(c.data.Expiry.Unix()))
+	}
+}
+
+// cacheContext returns context (derived from ctx, eg. collect run) for cache operations with timeout (if set)
+func (c *Collector) cacheContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// cacheLogger returns logger with cache fields (backend and url without query string)
+func (c *Collector) cacheLogger() *zap.SugaredLogger {
+	return c.logger.With(
+		zap.String("cache_backend", c.cache.protocol),
+		zap.String("cache_url", c.cache.redactedUrl()),
+	)
+}
+
+// redactedUrl returns cache url with redacted query string (eg. SAS tokens)
+func (spec *cacheSpecDef) redactedUrl() string {
+	if idx := strings.Index(spec.raw, "?"); idx >= 0 {
+		return spec.raw[:idx] + "?REDACTED"
+	}
+
+	return spec.raw
+}
+
+// cacheRead reads content from cache (and verifies checksum if integrity check is enabled)
+//
+//	integrity check needs the whole content in memory, so streamed content is read completely in this case
+func (c *Collector) cacheRead(ctx context.Context) (io.ReadCloser, bool) {
+	reader, exists := c.cacheReadBackend(ctx)
+	if exists && c.cacheConfig.integrityCheck {
+		defer reader.Close()
+
+		content, err := io.ReadAll(reader)
+		if err == nil {
+			content, err = cacheVerifyIntegrity(content)
+		}
+		if err != nil {
+			c.countError(errorStageCacheRead)
+			c.cacheLogger().Warnf(`cache integrity check failed, ignoring cache: %v`, err.Error())
+			return nil, false
+		}
+
+		return io.NopCloser(bytes.NewReader(content)), true
+	}
+
+	return reader, exists
+}
+
+// cacheStore saves content to cache (with checksum if integrity check is enabled)
+func (c *Collector) cacheStore(ctx context.Context, content []byte) error {
+	// collect run already canceled or timed out
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if c.cacheConfig.integrityCheck {
+		envelope, err := cacheAddIntegrity(content)
+		if err != nil {
+			return err
+		}
+		content = envelope
+	}
+
+	err := c.cacheStoreBackend(ctx, content)
+	if errors.Is(err, errCacheWriteSkipped) {
+		// backend is working, write is done by another writer
+		c.setCacheBackendStatus(nil)
+		return err
+	}
+	c.setCacheBackendStatus(err)
+	return err
+}
+
+// setCacheBackendStatus updates backend up metric and remembers last backend error
+func (c *Collector) setCacheBackendStatus(err error) {
+	if err != nil {
+		c.cacheState.backendError.message = err.Error()
+		c.cacheState.backendError.at = c.clock()
+	}
+
+	if c.cacheState.standalone {
+		return
+	}
+
+	if err != nil {
+		metricCacheBackendUp.WithLabelValues(c.Name, c.cache.protocol).Set(0)
+	} else {
+		metricCacheBackendUp.WithLabelValues(c.Name, c.cache.protocol).Set(1)
+	}
+}
+
+// cacheAddIntegrity wraps content into envelope with sha256 checksum
+func cacheAddIntegrity(content []byte) ([]byte, error) {
+	checksum := sha256.Sum256(content)
+	return json.Marshal(cacheIntegrityEnvelope{
+		Checksum: hex.EncodeToString(checksum[:]),
+		Payload:  content,
+	})
+}
+
+// cacheUnwrapIntegrity returns verified payload if content is an integrity envelope, other content is returned unchanged
+func cacheUnwrapIntegrity(content []byte) ([]byte, error) {
+	envelope := cacheIntegrityEnvelope{}
+	if err := json.Unmarshal(content, &envelope); err == nil && envelope.Checksum != "" {
+		return cacheVerifyIntegrity(content)
+	}
+
+	return content, nil
+}
+
+// cacheVerifyIntegrity unwraps envelope and verifies sha256 checksum of content
+func cacheVerifyIntegrity(content []byte) ([]byte, error) {
+	envelope := cacheIntegrityEnvelope{}
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Checksum == "" || len(envelope.Payload) == 0 {
+		return nil, fmt.Errorf(`cache checksum or payload missing`)
+	}
+
+	checksum := sha256.Sum256(envelope.Payload)
+	if hex.EncodeToString(checksum[:]) != envelope.Checksum {
+		return nil, fmt.Errorf(`cache checksum mismatch`)
+	}
+
+	return envelope.Payload, nil
+}
+
+// cacheReadBackend reads content from cache backend
+func (c *Collector) cacheReadBackend(ctx context.Context) (io.ReadCloser, bool) {
+	switch c.cache.protocol {
+	case cacheProtocolFile:
+		filePath := c.cache.spec["file:path"]
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			content, err := os.ReadFile(filePath) // #nosec inside container
+			c.setCacheBackendStatus(err)
+			if err != nil {
+				c.countError(errorStageCacheRead)
+				c.cacheLogger().Warnf(`unable to read cache: %v`, err.Error())
+				return nil, false
+			}
+			return io.NopCloser(bytes.NewReader(content)), true
+		}
+
+		c.setCacheBackendStatus(nil)
+	case cacheProtocolAzBlob:
+		ctx, cancel := c.cacheContext(ctx, c.cacheConfig.readTimeout)
+		defer cancel()
+
+		response, err := c.cache.readClient.(*azblob.Client).DownloadStream(ctx, c.cache.spec["azblob:container"], c.cache.spec["azblob:blob"], nil)
+		if err == nil || bloberror.HasCode(err, bloberror.BlobNotFound) {
+			c.setCacheBackendStatus(nil)
+		} else {
+			c.setCacheBackendStatus(err)
+		}
+
+		if err == nil {
+			defer response.Body.Close()
+
+			var reader io.Reader = response.Body
+
+			// transparent decompression if blob was uploaded compressed (eg. by other tools)
+			if strings.EqualFold(to.String(response.ContentEncoding), "gzip") {
+				gzipReader, err := gzip.NewReader(response.Body)
+				if err != nil {
+					c.setCacheBackendStatus(err)
+					c.countError(errorStageCacheRead)
+					c.cacheLogger().Warnf(`unable to decompress cache: %v`, err.Error())
+					return nil, false
+				}
+				defer gzipReader.Close()
+				reader = gzipReader
+			}
+
+			// stream large blobs to disk instead of keeping them in memory
+			if c.cacheConfig.streamSize > 0 && to.Int64(response.ContentLength) >= c.cacheConfig.streamSize {
+				tempFile, err := c.cacheDownloadToTempFile(reader)
+				if err == nil {
+					return tempFile, true
+				}
+
+				c.setCacheBackendStatus(err)
+				c.countError(errorStageCacheRead)
+				c.cacheLogger().Warnf(`unable to download cache to temp file: %v`, err.Error())
+				return nil, false
+			}
+
+			content, err := io.ReadAll(reader)
+			if err == nil {
+				return io.NopCloser(bytes.NewReader(content)), true
+			}
+
+			c.setCacheBackendStatus(err)
+			c.countError(errorStageCacheRead)
+			c.cacheLogger().Warnf(`unable to read cache: %v`, err.Error())
+		} else if !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			c.countError(errorStageCacheRead)
+			c.cacheLogger().Warnf(`unable to read cache: %v`, err.Error())
+		}
+	}
+
+	return nil, false
+}
+
+// cacheDownloadToTempFile writes content into temp file, file is removed when closed
+func (c *Collector) cacheDownloadToTempFile(reader io.Reader) (*cacheTempFile, error) {
+	file, err := os.CreateTemp("", "collector-cache-*")
+	if err != nil {
+		return nil, err
+	}
+
+	tempFile := &cacheTempFile{File: file}
+	if _, err := io.Copy(file, reader); err != nil {
+		tempFile.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		tempFile.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return tempFile, nil
+}
+
+// Close closes and removes the temp file
+func (f *cacheTempFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// cacheStoreBackend saves content to cache backend
+func (c *Collector) cacheStoreBackend(ctx context.Context, content []byte) error {
+	switch c.cache.protocol {
+	case cacheProtocolFile:
+		filePath := c.cache.spec["file:path"]
+
+		dirPath := filepath.Dir(filePath)
+
+		// ensure directory
+		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+			err := os.Mkdir(dirPath, 0700)
+			if err != nil {
+				return err
+			}
+		}
+
+		// calc tmp filename
+		tmpFilePath := filepath.Join(
+			dirPath,
+			fmt.Sprintf(
+				".%s.tmp",
+				filepath.Base(filePath),
+			),
+		)
+
+		// write to temp file first
+		err := os.WriteFile(tmpFilePath, content, 0600) // #nosec inside container
+		if err != nil {
+			return err
+		}
+
+		// rename file to final cache file (atomic operation)
+		err = os.Rename(tmpFilePath, filePath)
+		if err != nil {
+			return err
+		}
+	case cacheProtocolAzBlob:
+		opts := azblob.UploadBufferOptions{
+			AccessTier:  c.cacheConfig.blobTier,
+			Metadata:    c.cacheBlobMetadata(),
+			BlockSize:   c.cacheConfig.uploadOptions.blockSize,
+			Concurrency: c.cacheConfig.uploadOptions.concurrency,
+		}
+		ctx, cancel := c.cacheContext(ctx, c.cacheConfig.writeTimeout)
+		defer cancel()
+
+		accessConditions, release, err := c.cacheLeaseAccessConditions(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		opts.AccessConditions = accessConditions
+
+		_, err = c.cache.client.(*azblob.Client).UploadBuffer(ctx, c.cache.spec["azblob:container"], c.cache.spec["azblob:blob"], content, &opts)
+		if err != nil {
+			if c.cacheConfig.exclusiveWrite && cacheWriteConflict(err) {
+				return errCacheWriteSkipped
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cacheLeaseAccessConditions acquires lease for cache blob if exclusive write is enabled and returns
+// access conditions for the upload and a function releasing the lease
+//
+//	if the cache blob does not exist yet, the access conditions only allow the creation of the blob (see cacheWriteConflict)
+func (c *Collector) cacheLeaseAccessConditions(ctx context.Context) (*blob.AccessConditions, func(), error) {
+	if !c.cacheConfig.exclusiveWrite {
+		return nil, func() {}, nil
+	}
+
+	leaseClient, err := c.cacheAcquireLease(ctx)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	if leaseClient == nil {
+		// first write, blob is only created if it still does not exist (could be created by another writer meanwhile)
+		etagAny := azcore.ETagAny
+		accessConditions := &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: &etagAny,
+			},
+		}
+		return accessConditions, func() {}, nil
+	}
+
+	stopRenewal := c.cacheRenewLease(ctx, leaseClient)
+	release := func() {
+		stopRenewal()
+
+		// release lease with new context as ctx might be canceled already (eg. write timeout)
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), cacheLeaseReleaseTimeout)
+		defer releaseCancel()
+		if _, err := leaseClient.ReleaseLease(releaseCtx, nil); err != nil {
+			c.cacheLogger().Warnf(`unable to release cache blob lease: %v`, err.Error())
+		}
+	}
+
+	accessConditions := &blob.AccessConditions{
+		LeaseAccessConditions: &blob.LeaseAccessConditions{
+			LeaseID: leaseClient.LeaseID(),
+		},
+	}
+
+	return accessConditions, release, nil
+}
+
+// cacheWriteConflict checks if upload failed as the cache blob was created by another writer (first write, see cacheLeaseAccessConditions)
+func cacheWriteConflict(err error) bool {
+	return bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet)
+}
+
+// cacheAcquireLease acquires lease for cache blob (returns nil client if blob does not exist yet, see cacheLeaseAccessConditions),
+// returns errCacheWriteSkipped if blob is already leased by another writer
+func (c *Collector) cacheAcquireLease(ctx context.Context) (*lease.BlobClient, error) {
+	blobClient := c.cache.client.(*azblob.Client).ServiceClient().NewContainerClient(c.cache.spec["azblob:container"]).NewBlobClient(c.cache.spec["azblob:blob"])
+	leaseClient, err := lease.NewBlobClient(blobClient, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := leaseClient.AcquireLease(ctx, cacheLeaseDuration, nil); err != nil {
+		switch {
+		case bloberror.HasCode(err, bloberror.BlobNotFound):
+			// first write, nothing to lease yet
+			return nil, nil
+		case bloberror.HasCode(err, bloberror.LeaseAlreadyPresent):
+			return nil, errCacheWriteSkipped
+		}
+		return nil, err
+	}
+
+	return leaseClient, nil
+}
+
+// cacheRenewLease renews lease of cache blob until returned stop func is called (uploads could take longer than the lease duration)
+func (c *Collector) cacheRenewLease(ctx context.Context, leaseClient *lease.BlobClient) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(cacheLeaseRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := leaseClient.RenewLease(ctx, nil); err != nil {
+					c.cacheLogger().Warnf(`unable to renew cache blob lease: %v`, err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
 }
@@ -0,0 +1,294 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+type (
+	// cacheShardManifest is stored as cache blob if sharding is enabled, metric lists are stored as separate blobs
+	cacheShardManifest struct {
+		Data    map[string]interface{} `json:"data"`
+		Created *time.Time             `json:"created"`
+		Expiry  *time.Time             `json:"expiry"`
+		Tag     *string                `json:"tag"`
+
+		// Shards contains the sha256 checksum of each metric list shard (key is metric list name)
+		Shards map[string]string `json:"shards"`
+	}
+)
+
+// SetCacheSharded enables storing each metric list as separate blob (only azblob), only metric lists changed
+// compared to the stored manifest are uploaded and the cache blob is a manifest of all metric list blobs
+//
+//	metric list blobs are stored next to the cache blob (<blob>.shards/<metric list>.json),
+//	all collectors sharing the cache need sharding enabled as the manifest does not contain any metrics
+//	(ReadCache assembles the metric list blobs)
+func (c *Collector) SetCacheSharded(val bool) {
+	c.cacheConfig.sharded = val
+}
+
+// cacheIsSharded returns true if metric lists are stored as separate blobs
+func (c *Collector) cacheIsSharded() bool {
+	return c.cache != nil && c.cacheConfig.sharded && c.cache.protocol == cacheProtocolAzBlob
+}
+
+// cacheShardBlobName returns the blob name of the metric list shard
+func (c *Collector) cacheShardBlobName(name string) string {
+	return cacheShardPrefix(c.cache.spec["azblob:blob"]) + url.PathEscape(name) + ".json"
+}
+
+// cacheShardPrefix returns the blob name prefix of all shards of cache (manifest) blob
+func cacheShardPrefix(blobName string) string {
+	return blobName + ".shards/"
+}
+
+// cacheShardChecksum returns sha256 checksum of shard content
+func cacheShardChecksum(content []byte) string {
+	checksum := sha256.Sum256(content)
+	return hex.EncodeToString(checksum[:])
+}
+
+// cacheStoreSharded uploads changed metric lists as separate blobs and the manifest as cache blob,
+// shards of removed metric lists are deleted afterwards
+func (c *Collector) cacheStoreSharded(ctx context.Context) error {
+	// collect run already canceled or timed out
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// manifest and shards are built from the same state
+	snapshot := c.cacheSnapshot()
+	manifest := cacheShardManifest{
+		Data:    snapshot.Data,
+		Created: snapshot.Created,
+		Expiry:  snapshot.Expiry,
+		Tag:     snapshot.Tag,
+		Shards:  map[string]string{},
+	}
+
+	shards := map[string][]byte{}
+	for name, metricList := range snapshot.Metrics {
+		content, err := json.Marshal(metricList)
+		if err != nil {
+			return err
+		}
+
+		shards[name] = content
+		manifest.Shards[name] = cacheShardChecksum(content)
+	}
+
+	manifestContent, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	if c.cacheConfig.integrityCheck {
+		if manifestContent, err = cacheAddIntegrity(manifestContent); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := c.cacheContext(ctx, c.cacheConfig.writeTimeout)
+	defer cancel()
+
+	// lease manifest before uploading shards, so shards are not overwritten if another writer owns the cache
+	accessConditions, release, err := c.cacheLeaseAccessConditions(ctx)
+	if err != nil {
+		if errors.Is(err, errCacheWriteSkipped) {
+			c.setCacheBackendStatus(nil)
+		} else {
+			c.setCacheBackendStatus(err)
+		}
+		return err
+	}
+	defer release()
+
+	client := c.cache.client.(*azblob.Client)
+	container := c.cache.spec["azblob:container"]
+
+	// compare with stored manifest (not local state) as the shards might be written by another writer in the meantime
+	storedShards := c.cacheReadStoredShards(ctx)
+	changedShards := cacheChangedShards(manifest.Shards, storedShards)
+	for _, name := range changedShards {
+		content := shards[name]
+		opts := azblob.UploadBufferOptions{
+			AccessTier:  c.cacheConfig.blobTier,
+			Metadata:    c.cacheBlobMetadata(),
+			BlockSize:   c.cacheConfig.uploadOptions.blockSize,
+			Concurrency: c.cacheConfig.uploadOptions.concurrency,
+		}
+		if _, err := client.UploadBuffer(ctx, container, c.cacheShardBlobName(name), content, &opts); err != nil {
+			c.setCacheBackendStatus(err)
+			return fmt.Errorf(`unable to upload cache shard "%v": %w`, name, err)
+		}
+	}
+
+	opts := azblob.UploadBufferOptions{
+		AccessTier:       c.cacheConfig.blobTier,
+		Metadata:         c.cacheBlobMetadata(),
+		AccessConditions: accessConditions,
+	}
+	if _, err := client.UploadBuffer(ctx, container, c.cache.spec["azblob:blob"], manifestContent, &opts); err != nil {
+		if c.cacheConfig.exclusiveWrite && cacheWriteConflict(err) {
+			c.setCacheBackendStatus(nil)
+			return errCacheWriteSkipped
+		}
+		c.setCacheBackendStatus(err)
+		return err
+	}
+	c.setCacheBackendStatus(nil)
+
+	c.cacheLogger().Debugf(`uploaded %v of %v cache shards`, len(changedShards), len(manifest.Shards))
+
+	// remove shards of metric lists which are not part of the cache anymore
+	for name := range storedShards {
+		if _, exists := manifest.Shards[name]; exists {
+			continue
+		}
+
+		if _, err := client.DeleteBlob(ctx, container, c.cacheShardBlobName(name), nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			c.cacheLogger().Warnf(`unable to remove cache shard "%v": %v`, name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// cacheReadStoredShards returns shard checksums of the stored manifest (nil if manifest cannot be read, so all shards are uploaded)
+func (c *Collector) cacheReadStoredShards(ctx context.Context) map[string]string {
+	content, err := c.cacheDownloadBlob(ctx, c.cache.client.(*azblob.Client), c.cache.spec["azblob:container"], c.cache.spec["azblob:blob"])
+	if err != nil {
+		if !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			c.cacheLogger().Warnf(`unable to read stored cache manifest, uploading all shards: %v`, err.Error())
+		}
+		return nil
+	}
+
+	if content, err = cacheUnwrapIntegrity(content); err != nil {
+		return nil
+	}
+
+	if manifest, isManifest := cacheParseShardManifest(content); isManifest {
+		return manifest.Shards
+	}
+	return nil
+}
+
+// cacheChangedShards returns names of shards which checksum differs from stored shards
+func cacheChangedShards(shards, storedShards map[string]string) []string {
+	list := []string{}
+	for name, checksum := range shards {
+		if storedShards[name] != checksum {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// cacheParseShardManifest parses content as manifest, returns false if content is not a manifest (eg. cache written without sharding)
+func cacheParseShardManifest(content []byte) (*cacheShardManifest, bool) {
+	manifest := cacheShardManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.Shards == nil {
+		return nil, false
+	}
+
+	return &manifest, true
+}
+
+// cacheReadSharded reads all shards of the manifest in reader and returns the assembled cache content,
+// content is returned unchanged if it is not a manifest (eg. cache written without sharding)
+func (c *Collector) cacheReadSharded(ctx context.Context, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, isManifest := cacheParseShardManifest(content)
+	if !isManifest {
+		return bytes.NewReader(content), nil
+	}
+
+	ctx, cancel := c.cacheContext(ctx, c.cacheConfig.readTimeout)
+	defer cancel()
+
+	metrics := map[string]json.RawMessage{}
+	for name, checksum := range manifest.Shards {
+		shardContent, err := c.cacheDownloadBlob(ctx, c.cache.readClient.(*azblob.Client), c.cache.spec["azblob:container"], c.cacheShardBlobName(name))
+		if err != nil {
+			return nil, fmt.Errorf(`unable to read cache shard "%v": %w`, name, err)
+		}
+
+		// shard might be overwritten by another writer in the meantime
+		if cacheShardChecksum(shardContent) != checksum {
+			return nil, fmt.Errorf(`cache shard "%v" does not match manifest checksum`, name)
+		}
+
+		metrics[name] = shardContent
+	}
+
+	assembled, err := json.Marshal(struct {
+		Metrics map[string]json.RawMessage `json:"metrics"`
+		Data    map[string]interface{}     `json:"data"`
+		Created *time.Time                 `json:"created"`
+		Expiry  *time.Time                 `json:"expiry"`
+		Tag     *string                    `json:"tag"`
+	}{
+		Metrics: metrics,
+		Data:    manifest.Data,
+		Created: manifest.Created,
+		Expiry:  manifest.Expiry,
+		Tag:     manifest.Tag,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(assembled), nil
+}
+
+// cacheDeleteShards removes all shards of cache (manifest) blob, returns count of removed shards
+func (c *Collector) cacheDeleteShards(ctx context.Context, blobName string) (int, error) {
+	client := c.cache.client.(*azblob.Client)
+	container := c.cache.spec["azblob:container"]
+
+	removed := 0
+	prefix := cacheShardPrefix(blobName)
+	pager := client.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		result, err := pager.NextPage(ctx)
+		if err != nil {
+			return removed, err
+		}
+
+		if result.Segment == nil {
+			continue
+		}
+
+		for _, item := range result.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+
+			if _, err := client.DeleteBlob(ctx, container, *item.Name, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,967 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	armclient "github.com/webdevops/go-common/azuresdk/armclient"
+	"github.com/webdevops/go-common/azuresdk/cloudconfig"
+)
+
+func Test_CacheSpecTemplate(t *testing.T) {
+	t.Setenv("AZURE_ENVIRONMENT", "AzurePublicCloud")
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	c.SetCacheTemplateVar("subscription", "d7b0cf13-ddf7-43ea-81f1-6f659767a318")
+
+	specs := map[string]string{
+		"file:///cache/{collector}/{cloud}.json":                      "file:///cache/resources/AzurePublicCloud.json",
+		"azblob://account.blob.core.windows.net/cache/{subscription}": "azblob://account.blob.core.windows.net/cache/d7b0cf13-ddf7-43ea-81f1-6f659767a318",
+		"/cache/static.json": "/cache/static.json",
+	}
+
+	for spec, expected := range specs {
+		rendered, err := c.renderCacheSpec(spec)
+		if err != nil {
+			t.Fatalf(`expected no error for "%v", got: %v`, spec, err)
+		}
+
+		if rendered != expected {
+			t.Fatalf(`expected "%v" for "%v", got "%v"`, expected, spec, rendered)
+		}
+	}
+
+	if _, err := c.renderCacheSpec("/cache/{unknown}.json"); err == nil {
+		t.Fatalf(`expected error for unknown placeholder`)
+	}
+
+	// cloud defaults to public cloud
+	t.Setenv("AZURE_ENVIRONMENT", "")
+	if rendered, err := c.renderCacheSpec("/cache/{cloud}.json"); err != nil || rendered != "/cache/AzurePublicCloud.json" {
+		t.Fatalf(`expected "/cache/AzurePublicCloud.json" without AZURE_ENVIRONMENT, got "%v" (error: %v)`, rendered, err)
+	}
+}
+
+func Test_ReadCache(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(cachePath, []byte(`{"metrics":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ReadCache(context.Background(), "file://"+cachePath, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf(`expected no error, got: %v`, err)
+	}
+
+	if string(content) != `{"metrics":{}}` {
+		t.Fatalf(`unexpected cache content: %v`, string(content))
+	}
+
+	if _, err := ReadCache(context.Background(), filepath.Join(t.TempDir(), "missing.json"), nil); err == nil {
+		t.Fatalf(`expected error for missing cache`)
+	}
+
+	// cache written by collector (with integrity envelope) is returned unwrapped
+	c, _ := newTestCollector(t, cachePath, collectTestMetrics)
+	c.SetCacheIntegrityCheck(true)
+	registerTestMetrics(c)
+	c.run()
+
+	content, err = ReadCache(context.Background(), "file://"+cachePath, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf(`expected no error, got: %v`, err)
+	}
+
+	data := NewCollectorData()
+	if err := json.Unmarshal(content, data); err != nil {
+		t.Fatalf(`expected decodable cache content, got: %v`, err)
+	}
+	if metricList, exists := data.Metrics["gauge"]; !exists || len(metricList.List) != 1 {
+		t.Fatalf(`expected metric list "gauge" with 1 row in cache content`)
+	}
+
+	// reading the cache does not update collector metrics
+	if metricCacheBackendUp.DeleteLabelValues("cache", cacheProtocolFile) {
+		t.Fatalf(`expected no collector metrics for ReadCache`)
+	}
+
+	// shard manifests can only be assembled from azblob
+	if err := os.WriteFile(cachePath, []byte(`{"data":{},"shards":{"gauge":"abc"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCache(context.Background(), "file://"+cachePath, zap.NewNop().Sugar()); err == nil {
+		t.Fatalf(`expected error for shard manifest in file cache`)
+	}
+}
+
+func Test_CacheStorageTokenScope(t *testing.T) {
+	clouds := map[string]string{
+		"AzurePublicCloud":     "account.blob.core.windows.net",
+		"AzureChinaCloud":      "account.blob.core.chinacloudapi.cn",
+		"AzureGovernmentCloud": "account.blob.core.usgovcloudapi.net",
+	}
+
+	for cloudName, host := range clouds {
+		cloudConfig, err := cloudconfig.NewCloudConfig(cloudName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if scope := cacheStorageTokenScope(cloudConfig.Configuration, host); scope != "https://storage.azure.com/.default" {
+			t.Fatalf(`unexpected storage token scope for %v: %v`, cloudName, scope)
+		}
+
+		if suffix := cloudConfig.Services[cloudconfig.ServiceNameStorage].Endpoint; !strings.HasSuffix(host, suffix) {
+			t.Fatalf(`unexpected storage endpoint suffix for %v: %v`, cloudName, suffix)
+		}
+	}
+
+	// cloud without storage configuration (eg. AzurePrivateCloud)
+	if scope := cacheStorageTokenScope(cloudconfig.CloudEnvironment{}.Configuration, "account.blob.azurestack.local"); scope != "https://account.blob.azurestack.local/.default" {
+		t.Fatalf(`unexpected storage token scope for private cloud: %v`, scope)
+	}
+}
+
+func Test_CacheAzBlobSharedKey(t *testing.T) {
+	t.Setenv(EnvCacheStorageKey, "dGVzdA==")
+
+	specs := map[string]bool{
+		"azblob://account.blob.core.windows.net/cache/resources.json?auth=sharedkey":                                                  true,
+		"azblob://account.blob.core.windows.net/cache/resources.json?auth=sharedkey&readhost=account-secondary.blob.core.windows.net": true,
+		"azblob://account.blob.core.windows.net/cache/resources.json?auth=sharedkey&readhost=replica.blob.core.windows.net":           false,
+	}
+
+	for spec, valid := range specs {
+		c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+		cacheSpec, err := parseCacheSpec(spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.cache = cacheSpec
+
+		if err := c.setupCacheBackend(); (err == nil) != valid {
+			t.Fatalf(`unexpected result for "%v": %v`, spec, err)
+		}
+	}
+}
+
+func Test_TrySetCacheAzBlobWithoutEnvironment(t *testing.T) {
+	t.Setenv("AZURE_ENVIRONMENT", "")
+	t.Setenv(EnvCacheStorageKey, "")
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+
+	cacheSpec := "azblob://account.blob.core.windows.net/cache/resources.json"
+	if err := c.TrySetCache(&cacheSpec, nil); err == nil {
+		t.Fatalf(`expected error for azblob cache without Azure environment`)
+	}
+
+	if c.cache != nil {
+		t.Fatalf(`expected cache to be disabled after failed setup`)
+	}
+}
+
+func Test_VerifyCacheWritable(t *testing.T) {
+	cacheDir := t.TempDir()
+	cachePath := filepath.Join(cacheDir, "cache.json")
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	if err := c.VerifyCacheWritable(context.Background()); err == nil {
+		t.Fatalf(`expected error without cache`)
+	}
+
+	c.SetCache(&cachePath, nil)
+	if err := c.VerifyCacheWritable(context.Background()); err != nil {
+		t.Fatalf(`expected cache to be writable, got: %v`, err)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf(`expected test file to be removed, found %v files`, len(entries))
+	}
+}
+
+func Test_CompactCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	cachePath := filepath.Join(cacheDir, "cache.json")
+
+	now := time.Now()
+	files := map[string]string{
+		"expired-long.json":  fmt.Sprintf(`{"expiry":%q}`, now.Add(-2*time.Hour).Format(time.RFC3339)),
+		"expired-short.json": fmt.Sprintf(`{"expiry":%q}`, now.Add(-10*time.Minute).Format(time.RFC3339)),
+		"valid.json":         fmt.Sprintf(`{"expiry":%q}`, now.Add(1*time.Hour).Format(time.RFC3339)),
+		"other.txt":          `not a cache`,
+		"expired.data":       fmt.Sprintf(`{"expiry":%q}`, now.Add(-2*time.Hour).Format(time.RFC3339)),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cacheDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	c.SetCache(&cachePath, nil)
+
+	if removed, err := c.CompactCache(context.Background(), 1*time.Hour); err != nil || removed != 1 {
+		t.Fatalf(`expected 1 removed cache (expired for more than 1h), got %v (error: %v)`, removed, err)
+	}
+
+	if removed, err := c.CompactCache(context.Background(), 0); err != nil || removed != 1 {
+		t.Fatalf(`expected 1 removed cache (expired), got %v (error: %v)`, removed, err)
+	}
+
+	// files not matching the cache file name pattern are kept
+	for _, name := range []string{"valid.json", "other.txt", "expired.data"} {
+		if _, err := os.Stat(filepath.Join(cacheDir, name)); err != nil {
+			t.Fatalf(`expected "%v" to be kept, got: %v`, name, err)
+		}
+	}
+}
+
+func Test_CacheCompactionCandidate(t *testing.T) {
+	candidates := map[string]bool{
+		"resources.json":                        true,
+		"resources-other.json":                  true,
+		"resources.json.writetest-1a2b3c":       false,
+		"resources.json.shards/gauge.json":      false,
+		"other/resources.json":                  false,
+		"data.csv":                              false,
+		"exporter/resources.json":               false,
+		"exporter/resources.json.shards/a.json": false,
+	}
+
+	for name, expected := range candidates {
+		if candidate := isCacheCompactionCandidate("resources.json", name); candidate != expected {
+			t.Fatalf(`expected "%v" compaction candidate=%v, got %v`, name, expected, candidate)
+		}
+	}
+
+	if !isCacheCompactionCandidate("exporter/resources.json", "exporter/resources-old.json") {
+		t.Fatalf(`expected cache blob in same directory to be compaction candidate`)
+	}
+}
+
+func Test_CacheBlobTier(t *testing.T) {
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+
+	tiers := map[string]bool{
+		"Hot":     true,
+		"cool":    true,
+		"Cold":    true,
+		"Archive": false,
+		"P10":     false,
+		"Premium": false,
+		"invalid": false,
+	}
+
+	for tier, valid := range tiers {
+		c.cacheConfig.blobTier = nil
+		if err := c.SetCacheBlobTier(tier); (err == nil) != valid {
+			t.Fatalf(`unexpected result for access tier "%v": %v`, tier, err)
+		}
+
+		if valid && !strings.EqualFold(string(*c.cacheConfig.blobTier), tier) {
+			t.Fatalf(`expected access tier "%v", got "%v"`, tier, *c.cacheConfig.blobTier)
+		}
+		if !valid && c.cacheConfig.blobTier != nil {
+			t.Fatalf(`expected no access tier to be set for "%v"`, tier)
+		}
+	}
+}
+
+func Test_CacheBlobMetadata(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	c.SetCache(&cachePath, BuildCacheTag("test"))
+
+	if err := c.SetCacheMetadata(map[string]string{"exporter-version": "1.0.0"}); err == nil {
+		t.Fatalf(`expected error for invalid metadata key`)
+	}
+
+	if err := c.SetCacheMetadata(map[string]string{"exporter_version": "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := c.cacheBlobMetadata()
+	expected := map[string]string{
+		"exporter_version": "1.0.0",
+		"collector":        "resources",
+		"tag":              *BuildCacheTag("test"),
+	}
+	for key, value := range expected {
+		if metadata[key] == nil || *metadata[key] != value {
+			t.Fatalf(`expected metadata "%v" to be "%v", got %v`, key, value, metadata[key])
+		}
+	}
+
+	if _, exists := metadata["hostname"]; !exists {
+		t.Fatalf(`expected hostname in metadata`)
+	}
+}
+
+func Test_CacheBlobUploadOptions(t *testing.T) {
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+
+	if err := c.SetCacheBlobUploadOptions(8*1024*1024, 4); err != nil {
+		t.Fatal(err)
+	}
+	if c.cacheConfig.uploadOptions.blockSize != 8*1024*1024 || c.cacheConfig.uploadOptions.concurrency != 4 {
+		t.Fatalf(`expected block size 8MiB and concurrency 4, got %+v`, c.cacheConfig.uploadOptions)
+	}
+
+	invalidOptions := []struct {
+		blockSize   int64
+		concurrency int
+	}{
+		{blockSize: -1, concurrency: 0},
+		{blockSize: blockblob.MaxStageBlockBytes + 1, concurrency: 0},
+		{blockSize: 0, concurrency: -1},
+		{blockSize: 0, concurrency: math.MaxUint16 + 1},
+	}
+
+	for _, opts := range invalidOptions {
+		if err := c.SetCacheBlobUploadOptions(opts.blockSize, opts.concurrency); err == nil {
+			t.Fatalf(`expected error for block size %v and concurrency %v`, opts.blockSize, opts.concurrency)
+		}
+	}
+
+	// invalid options keep the previous options
+	if c.cacheConfig.uploadOptions.blockSize != 8*1024*1024 || c.cacheConfig.uploadOptions.concurrency != 4 {
+		t.Fatalf(`expected previous upload options to be kept, got %+v`, c.cacheConfig.uploadOptions)
+	}
+
+	// zero values use azblob defaults
+	if err := c.SetCacheBlobUploadOptions(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if c.cacheConfig.uploadOptions.blockSize != 0 || c.cacheConfig.uploadOptions.concurrency != 0 {
+		t.Fatalf(`expected default upload options, got %+v`, c.cacheConfig.uploadOptions)
+	}
+}
+
+func Test_ParseCacheSpec(t *testing.T) {
+	specs := map[string]CacheSpec{
+		"/cache/resources.json":        {Protocol: "file", Path: "/cache/resources.json"},
+		"file:///cache/resources.json": {Protocol: "file", Path: "/cache/resources.json"},
+		"azblob://account.blob.core.windows.net/cache/resources.json": {
+			Protocol:  "azblob",
+			Host:      "account.blob.core.windows.net",
+			Container: "cache",
+			Blob:      "resources.json",
+		},
+		"azblob://account.blob.core.windows.net/cache/exporter/resources.json?auth=sharedkey&readhost=account-secondary.blob.core.windows.net": {
+			Protocol:  "azblob",
+			Host:      "account.blob.core.windows.net",
+			Container: "cache",
+			Blob:      "exporter/resources.json",
+			ReadHost:  "account-secondary.blob.core.windows.net",
+			Auth:      "sharedkey",
+		},
+		"/cache/{collector}-{cloud}.json": {Protocol: "file", Path: "/cache/{collector}-{cloud}.json"},
+		"azblob://{account}.blob.core.windows.net/{container}/{cloud}/{collector}.json?readhost={account}-secondary.blob.core.windows.net": {
+			Protocol:  "azblob",
+			Host:      "{account}.blob.core.windows.net",
+			Container: "{container}",
+			Blob:      "{cloud}/{collector}.json",
+			ReadHost:  "{account}-secondary.blob.core.windows.net",
+		},
+	}
+
+	for rawSpec, expected := range specs {
+		spec, err := ParseCacheSpec(rawSpec)
+		if err != nil {
+			t.Fatalf(`expected no error for "%v", got: %v`, rawSpec, err)
+		}
+
+		if *spec != expected {
+			t.Fatalf(`expected %+v for "%v", got %+v`, expected, rawSpec, *spec)
+		}
+	}
+
+	invalidSpecs := []string{
+		"",
+		"azblob://account.blob.core.windows.net/cache",
+		"azblob://account.blob.core.windows.net/cache/",
+		"azblob://account.blob.core.windows.net/cache/resources.json?auth=invalid",
+	}
+
+	for _, rawSpec := range invalidSpecs {
+		if _, err := ParseCacheSpec(rawSpec); err == nil {
+			t.Fatalf(`expected error for "%v"`, rawSpec)
+		}
+	}
+}
+
+func Test_ParseCacheSpecAzBlobPath(t *testing.T) {
+	specs := map[string][2]string{
+		"azblob://account.blob.core.windows.net/cache/resources.json":                 {"cache", "resources.json"},
+		"azblob://account.blob.core.windows.net/cache/exporter/resources.json":        {"cache", "exporter/resources.json"},
+		"azblob://account.blob.core.windows.net/cache/exporter/sub/resources.json":    {"cache", "exporter/sub/resources.json"},
+		"azblob://account.blob.core.windows.net/cache/resources.json?readhost=backup": {"cache", "resources.json"},
+	}
+
+	for rawSpec, expected := range specs {
+		spec, err := parseCacheSpec(rawSpec, nil)
+		if err != nil {
+			t.Fatalf(`expected no error for "%v", got: %v`, rawSpec, err)
+		}
+
+		// leading slash of url path must not be part of container name
+		if container := spec.spec["azblob:container"]; container != expected[0] {
+			t.Fatalf(`expected container "%v" for "%v", got "%v"`, expected[0], rawSpec, container)
+		}
+		if blob := spec.spec["azblob:blob"]; blob != expected[1] {
+			t.Fatalf(`expected blob "%v" for "%v", got "%v"`, expected[1], rawSpec, blob)
+		}
+	}
+
+	for _, rawSpec := range []string{"azblob://account.blob.core.windows.net/", "azblob://account.blob.core.windows.net//resources.json"} {
+		if _, err := parseCacheSpec(rawSpec, nil); err == nil {
+			t.Fatalf(`expected error for "%v"`, rawSpec)
+		}
+	}
+}
+
+// testBlobServer is an in-memory fake of the azblob api (upload, download, delete and blob leases)
+type testBlobServer struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	blobs    map[string][]byte
+	leases   map[string]string
+	requests []string
+
+	// hook is called before a request is handled
+	hook func(r *http.Request)
+}
+
+func newTestBlobServer(t *testing.T) *testBlobServer {
+	t.Helper()
+
+	server := &testBlobServer{
+		blobs:  map[string][]byte{},
+		leases: map[string]string{},
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestBlobCollector creates collector with azblob cache using the fake blob server
+func newTestBlobCollector(t *testing.T, server *testBlobServer) *Collector {
+	t.Helper()
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+
+	cacheSpec, err := parseCacheSpec("azblob://account.blob.core.windows.net/cache/resources.json", BuildCacheTag("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := azblob.NewClientWithNoCredential(server.URL, &azblob.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Retry: policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheSpec.client = client
+	cacheSpec.readClient = client
+	c.cache = cacheSpec
+
+	return c
+}
+
+// blob returns content of blob (nil if blob does not exist)
+func (s *testBlobServer) blob(name string) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.blobs[name]
+}
+
+// setBlob sets content of blob
+func (s *testBlobServer) setBlob(name string, content []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blobs[name] = content
+}
+
+// lease returns active lease id of blob
+func (s *testBlobServer) lease(name string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.leases[name]
+}
+
+// setLease sets active lease id of blob
+func (s *testBlobServer) setLease(name, leaseID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leases[name] = leaseID
+}
+
+// countRequests returns count of handled requests (eg. "PUT cache/resources.json lease:renew")
+func (s *testBlobServer) countRequests(request string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for _, val := range s.requests {
+		if val == request {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *testBlobServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.hook != nil {
+		s.hook(r)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	request := r.Method + " " + name
+	if action := r.Header.Get("x-ms-lease-action"); r.URL.Query().Get("comp") == "lease" {
+		request += " lease:" + action
+	}
+	s.requests = append(s.requests, request)
+
+	content, exists := s.blobs[name]
+	leaseID := s.leases[name]
+
+	writeError := func(status int, code string) {
+		w.Header().Set("x-ms-error-code", code)
+		w.WriteHeader(status)
+	}
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "lease":
+		if !exists {
+			writeError(http.StatusNotFound, "BlobNotFound")
+			return
+		}
+
+		switch r.Header.Get("x-ms-lease-action") {
+		case "acquire":
+			if leaseID != "" {
+				writeError(http.StatusConflict, "LeaseAlreadyPresent")
+				return
+			}
+			s.leases[name] = r.Header.Get("x-ms-proposed-lease-id")
+			w.Header().Set("x-ms-lease-id", s.leases[name])
+			w.WriteHeader(http.StatusCreated)
+		case "renew", "release":
+			if leaseID != r.Header.Get("x-ms-lease-id") {
+				writeError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation")
+				return
+			}
+			if r.Header.Get("x-ms-lease-action") == "release" {
+				delete(s.leases, name)
+			}
+			w.Header().Set("x-ms-lease-id", leaseID)
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeError(http.StatusBadRequest, "InvalidHeaderValue")
+		}
+	case r.Method == http.MethodPut:
+		if exists && r.Header.Get("If-None-Match") == "*" {
+			writeError(http.StatusConflict, "BlobAlreadyExists")
+			return
+		}
+		if leaseID != "" && r.Header.Get("x-ms-lease-id") != leaseID {
+			writeError(http.StatusPreconditionFailed, "LeaseIdMismatchWithBlobOperation")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		s.blobs[name] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(body)))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		if !exists {
+			writeError(http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(s.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet:
+		if !exists {
+			writeError(http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content)
+	default:
+		writeError(http.StatusMethodNotAllowed, "UnsupportedHttpVerb")
+	}
+}
+
+func Test_CacheExclusiveWrite(t *testing.T) {
+	server := newTestBlobServer(t)
+	c := newTestBlobCollector(t, server)
+	c.SetCacheExclusiveWrite(true)
+
+	// first write creates blob without lease
+	if err := c.cacheStoreBackend(context.Background(), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if content := server.blob("cache/resources.json"); string(content) != "v1" {
+		t.Fatalf(`expected blob to be created with "v1", got "%s"`, content)
+	}
+
+	// next write leases blob and releases lease afterwards
+	if err := c.cacheStoreBackend(context.Background(), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if content := server.blob("cache/resources.json"); string(content) != "v2" {
+		t.Fatalf(`expected blob to be updated with "v2", got "%s"`, content)
+	}
+	if server.countRequests("PUT cache/resources.json lease:acquire") != 2 || server.countRequests("PUT cache/resources.json lease:release") != 1 {
+		t.Fatalf(`expected lease to be acquired and released, got requests %v`, server.requests)
+	}
+	if leaseID := server.lease("cache/resources.json"); leaseID != "" {
+		t.Fatalf(`expected lease to be released, got lease "%v"`, leaseID)
+	}
+
+	// blob is leased by another writer
+	server.setLease("cache/resources.json", "other-writer")
+	if err := c.cacheStoreBackend(context.Background(), []byte("v3")); !errors.Is(err, errCacheWriteSkipped) {
+		t.Fatalf(`expected write to be skipped for leased blob, got: %v`, err)
+	}
+	if content := server.blob("cache/resources.json"); string(content) != "v2" {
+		t.Fatalf(`expected blob to be unchanged, got "%s"`, content)
+	}
+}
+
+func Test_CacheExclusiveWriteFirstWriteRace(t *testing.T) {
+	server := newTestBlobServer(t)
+	c := newTestBlobCollector(t, server)
+	c.SetCacheExclusiveWrite(true)
+
+	// blob is created by another writer after lease attempt of the first write
+	server.hook = func(r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" {
+			server.setBlob("cache/resources.json", []byte("other"))
+		}
+	}
+
+	if err := c.cacheStoreBackend(context.Background(), []byte("v1")); !errors.Is(err, errCacheWriteSkipped) {
+		t.Fatalf(`expected first write to be skipped if blob was created meanwhile, got: %v`, err)
+	}
+	if content := server.blob("cache/resources.json"); string(content) != "other" {
+		t.Fatalf(`expected blob of other writer to be kept, got "%s"`, content)
+	}
+}
+
+func Test_CacheExclusiveWriteLeaseRenewal(t *testing.T) {
+	renewInterval := cacheLeaseRenewInterval
+	cacheLeaseRenewInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		cacheLeaseRenewInterval = renewInterval
+	})
+
+	server := newTestBlobServer(t)
+	server.setBlob("cache/resources.json", []byte("v1"))
+	c := newTestBlobCollector(t, server)
+	c.SetCacheExclusiveWrite(true)
+
+	// slow upload, lease needs to be renewed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server.hook = func(r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if err := c.cacheStoreBackend(ctx, []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.countRequests("PUT cache/resources.json lease:renew"); count == 0 {
+		t.Fatalf(`expected lease to be renewed during upload`)
+	}
+
+	// upload is canceled, lease is released nevertheless
+	server.hook = func(r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" {
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	if err := c.cacheStoreBackend(ctx, []byte("v3")); err == nil {
+		t.Fatalf(`expected error for canceled upload`)
+	}
+	if leaseID := server.lease("cache/resources.json"); leaseID != "" {
+		t.Fatalf(`expected lease to be released after canceled upload, got lease "%v"`, leaseID)
+	}
+}
+
+type testTokenCredential struct {
+	tenantID string
+}
+
+func (cred *testTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	cred.tenantID = opts.TenantID
+	return azcore.AccessToken{Token: "test", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func Test_CacheTenantCredential(t *testing.T) {
+	t.Setenv("AZURE_ENVIRONMENT", "AzurePublicCloud")
+
+	baseCred := &testTokenCredential{}
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	c.SetCacheCredential(baseCred)
+	c.SetCacheTenant("b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90")
+
+	cacheSpec := "azblob://account.blob.core.windows.net/cache/resources.json"
+	if err := c.TrySetCache(&cacheSpec, nil); err != nil {
+		t.Fatalf(`unable to setup azblob cache with custom credential: %v`, err)
+	}
+
+	// token requests of the wired azblob credential must use the cache tenant
+	if c.cache.credential == nil {
+		t.Fatalf(`expected azblob cache to use token credential`)
+	}
+	if _, err := c.cache.credential.GetToken(context.Background(), policy.TokenRequestOptions{TenantID: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if baseCred.tenantID != "b3c1e2a4-4d8f-4f0e-9d61-2f3c5a7b8e90" {
+		t.Fatalf(`expected token request for cache tenant, got "%v"`, baseCred.tenantID)
+	}
+
+	// shared key authentication does not use the token credential
+	t.Setenv(EnvCacheStorageKey, "dGVzdA==")
+	cacheSpec = "azblob://account.blob.core.windows.net/cache/resources.json?auth=sharedkey"
+	if err := c.TrySetCache(&cacheSpec, nil); err != nil {
+		t.Fatalf(`unable to setup azblob cache with shared key: %v`, err)
+	}
+	if c.cache.credential != nil {
+		t.Fatalf(`expected azblob cache with shared key not to use token credential`)
+	}
+}
+
+// testRoundTripper records requested hosts and responds with container not found
+type testRoundTripper struct {
+	lock  sync.Mutex
+	hosts []string
+}
+
+func (rt *testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.hosts = append(rt.hosts, req.URL.Hostname())
+
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"X-Ms-Error-Code": []string{"ContainerNotFound"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func Test_CacheArmClientTransport(t *testing.T) {
+	// cache ArmClient is used instead of ArmClient from environment
+	t.Setenv("AZURE_ENVIRONMENT", "")
+	t.Setenv(EnvCacheStorageKey, "dGVzdA==")
+
+	cloudConfig, err := cloudconfig.NewCloudConfig("AzurePublicCloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &testRoundTripper{}
+	azureClient := armclient.NewArmClient(cloudConfig, zap.NewNop().Sugar())
+	azureClient.SetHTTPClient(&http.Client{Transport: transport})
+
+	specs := []string{
+		"azblob://account.blob.core.windows.net/cache/resources.json",
+		"azblob://account.blob.core.windows.net/cache/resources.json?auth=sharedkey",
+	}
+
+	for _, spec := range specs {
+		c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+		c.SetCacheCredential(&testTokenCredential{})
+		c.SetCacheArmClient(azureClient)
+		if err := c.TrySetCache(&spec, nil); err != nil {
+			t.Fatalf(`unable to setup azblob cache "%v" with ArmClient: %v`, spec, err)
+		}
+
+		if _, err := c.CacheBackendInfo(); err == nil {
+			t.Fatalf(`expected container not found error for "%v"`, spec)
+		}
+	}
+
+	if len(transport.hosts) != len(specs) {
+		t.Fatalf(`expected all azblob requests to use transport of ArmClient, got requests for %v`, transport.hosts)
+	}
+}
+
+func Test_CacheSharded(t *testing.T) {
+	t.Setenv("AZURE_ENVIRONMENT", "AzurePublicCloud")
+
+	c := New("resources", &testProcessor{}, zap.NewNop().Sugar())
+	c.SetCacheCredential(&testTokenCredential{})
+	c.SetCacheSharded(true)
+
+	cacheSpec := "azblob://account.blob.core.windows.net/cache/exporter/resources.json"
+	if err := c.TrySetCache(&cacheSpec, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.cacheIsSharded() {
+		t.Fatalf(`expected azblob cache to be sharded`)
+	}
+
+	if name := c.cacheShardBlobName("resource/info"); name != "exporter/resources.json.shards/resource%2Finfo.json" {
+		t.Fatalf(`unexpected shard blob name "%v"`, name)
+	}
+
+	// caches written without sharding are restored as is
+	content := `{"metrics":{},"data":{},"created":null,"expiry":null,"tag":null}`
+	reader, err := c.cacheReadSharded(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored, _ := io.ReadAll(reader); string(restored) != content {
+		t.Fatalf(`expected unchanged cache content, got "%s"`, restored)
+	}
+
+	// file caches are never sharded
+	fileCacheSpec := filepath.Join(t.TempDir(), "cache.json")
+	c.SetCache(&fileCacheSpec, nil)
+	if c.cacheIsSharded() {
+		t.Fatalf(`expected file cache not to be sharded`)
+	}
+}
+
+func Test_CacheShardedBlob(t *testing.T) {
+	server := newTestBlobServer(t)
+	c := newTestBlobCollector(t, server)
+	c.SetCacheSharded(true)
+	registerTestMetrics(c)
+	collectTestMetrics(c)
+	sleepTime := 1 * time.Hour
+	c.sleepTime = &sleepTime
+	c.prepareCacheData()
+
+	shardUploads := func() int {
+		count := 0
+		for _, name := range []string{"gauge", "counter", "histogram", "summary"} {
+			count += server.countRequests("PUT cache/resources.json.shards/" + name + ".json")
+		}
+		return count
+	}
+
+	// first write uploads all shards
+	if err := c.cacheStoreSharded(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := shardUploads(); count != 4 {
+		t.Fatalf(`expected 4 shard uploads, got %v`, count)
+	}
+
+	// only changed metric list is uploaded again
+	c.GetMetricList("gauge").Add(prometheus.Labels{"name": "bar"}, 1)
+	if err := c.cacheStoreSharded(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := shardUploads(); count != 5 {
+		t.Fatalf(`expected only changed shard to be uploaded, got %v shard uploads`, count)
+	}
+	if count := server.countRequests("PUT cache/resources.json.shards/gauge.json"); count != 2 {
+		t.Fatalf(`expected gauge shard to be uploaded again, got %v uploads`, count)
+	}
+
+	// shard of removed metric list is deleted
+	delete(c.data.Metrics, "summary")
+	if err := c.cacheStoreSharded(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.blob("cache/resources.json.shards/summary.json") != nil {
+		t.Fatalf(`expected shard of removed metric list to be deleted`)
+	}
+	if count := shardUploads(); count != 5 {
+		t.Fatalf(`expected no shard uploads for unchanged metric lists, got %v shard uploads`, count)
+	}
+
+	// manifest and shards are restored
+	reader, err := c.cacheReadSharded(context.Background(), bytes.NewReader(server.blob("cache/resources.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := CollectorData{}
+	if err := json.NewDecoder(reader).Decode(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := restored.Metrics["gauge"]; !exists || len(restored.Metrics) != 3 {
+		t.Fatalf(`expected restored cache to contain 3 metric lists, got %v`, restored.Metrics)
+	}
+
+	// shard was overwritten by another writer
+	server.setBlob("cache/resources.json.shards/gauge.json", []byte(`{"list":[]}`))
+	if _, err := c.cacheReadSharded(context.Background(), bytes.NewReader(server.blob("cache/resources.json"))); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf(`expected checksum mismatch of modified shard, got: %v`, err)
+	}
+}
+
+func Test_CacheChangedShards(t *testing.T) {
+	shards := map[string]string{"counter": "c1", "gauge": "g2", "info": "i1"}
+
+	testCases := []struct {
+		name         string
+		storedShards map[string]string
+		expected     []string
+	}{
+		{name: "without stored manifest", storedShards: nil, expected: []string{"counter", "gauge", "info"}},
+		{name: "unchanged", storedShards: map[string]string{"counter": "c1", "gauge": "g2", "info": "i1"}, expected: []string{}},
+		{name: "changed by other writer", storedShards: map[string]string{"counter": "c1", "gauge": "g1", "info": "i1"}, expected: []string{"gauge"}},
+		{name: "missing in stored manifest", storedShards: map[string]string{"counter": "c1", "removed": "r1"}, expected: []string{"gauge", "info"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			changed := cacheChangedShards(shards, testCase.storedShards)
+			if strings.Join(changed, ",") != strings.Join(testCase.expected, ",") {
+				t.Fatalf(`expected changed shards %v, got %v`, testCase.expected, changed)
+			}
+		})
+	}
+}
@@ -2,9 +2,13 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -12,18 +16,40 @@ import (
 	"github.com/remeh/sizedwaitgroup"
 	"github.com/robfig/cron"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	prometheusCommon "github.com/webdevops/go-common/prometheus"
 )
 
+var (
+	metricPrefixRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
 type Collector struct {
 	Name string
 
 	context context.Context
 
-	scrapeTime *time.Duration
-	sleepTime  *time.Duration
-	cronSpec   *string
+	// runContext is the context of the running collect (see Processor.Context)
+	runContext     context.Context
+	runContextLock sync.RWMutex
+
+	// collectDone is closed after Collect of the last collect run has returned
+	collectDone chan struct{}
+
+	scrapeTime     *time.Duration
+	sleepTime      *time.Duration
+	cronSpec       *string
+	collectTimeout time.Duration
+	maxSeries      int
+	metricPrefix   string
+	valueTransform func(name string, value float64) float64
+
+	scrapeCoordinator *ScrapeCoordinator
+
+	staleGrace time.Duration
+
+	maxLabelValueLength int
 
 	cron *cron.Cron
 
@@ -32,7 +58,12 @@ type Collector struct {
 	nextScrapeTime      *time.Time
 	collectionStartTime time.Time
 
-	cache *cacheSpecDef
+	// nextScrapeTimeLock guards nextScrapeTime (read by NextScrapeTime from other goroutines)
+	nextScrapeTimeLock sync.RWMutex
+
+	cache       *cacheSpecDef
+	cacheConfig cacheConfigDef
+	cacheState  cacheStateDef
 
 	panic struct {
 		threshold int64
@@ -40,6 +71,12 @@ type Collector struct {
 		backoff   []time.Duration
 	}
 
+	failureBackoff struct {
+		base     time.Duration
+		max      time.Duration
+		failures int
+	}
+
 	data *CollectorData
 
 	registry *prometheus.Registry
@@ -47,9 +84,17 @@ type Collector struct {
 	concurrency int
 	waitGroup   *sizedwaitgroup.SizedWaitGroup
 
+	// runLock serializes scheduled runs and CollectNow (buffered channel with size 1)
+	runLock chan struct{}
+
 	logger *zap.SugaredLogger
 
+	// core of logger (see SetLogSampling)
+	logCore *logSamplingCore
+
 	processor ProcessorInterface
+
+	clock func() time.Time
 }
 
 type CollectorData struct {
@@ -86,6 +131,8 @@ func New(name string, processor ProcessorInterface, logger *zap.SugaredLogger) *
 	c.data = NewCollectorData()
 	c.processor = processor
 	c.concurrency = -1
+	c.clock = time.Now
+	c.runLock = make(chan struct{}, 1)
 	c.panic.threshold = 5
 	c.panic.counter = 0
 	c.panic.backoff = []time.Duration{
@@ -94,7 +141,10 @@ func New(name string, processor ProcessorInterface, logger *zap.SugaredLogger) *
 		10 * time.Minute,
 	}
 	if logger != nil {
-		c.logger = logger.With(zap.String(`collector`, name))
+		c.logger = logger.With(zap.String(`collector`, name)).Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			c.logCore = newLogSamplingCore(core)
+			return c.logCore
+		})).Sugar()
 	}
 	processor.Setup(c)
 
@@ -102,6 +152,12 @@ func New(name string, processor ProcessorInterface, logger *zap.SugaredLogger) *
 
 	metricInfo.WithLabelValues(c.Name).Set(1)
 	metricPanicCount.WithLabelValues(c.Name).Add(0)
+	metricCacheTagMismatch.WithLabelValues(c.Name).Add(0)
+	metricCollectTimeout.WithLabelValues(c.Name).Add(0)
+	metricScrapeSuccess.WithLabelValues(c.Name).Set(0)
+	for _, stage := range []string{errorStageCollect, errorStageCacheRead, errorStageCacheWrite} {
+		metricErrors.WithLabelValues(c.Name, stage).Add(0)
+	}
 
 	return c
 }
@@ -141,6 +197,15 @@ func (c *Collector) GetPanicBackoff() []time.Duration {
 	return c.panic.backoff
 }
 
+// SetFailureBackoff enables exponential backoff of the sleep duration after consecutive failed collect runs
+// (base, 2*base, 4*base, ... up to max), backoff is reset after a successful run and replaces the panic backoff
+//
+//	max lower or equal base disables the exponential growth (constant backoff of base)
+func (c *Collector) SetFailureBackoff(base, max time.Duration) {
+	c.failureBackoff.base = base
+	c.failureBackoff.max = max
+}
+
 // SetCronSpec sets cronspec for collector (using cron for schedule)
 func (c *Collector) SetCronSpec(cron *cron.Cron, cronSpec string) {
 	c.cron = cron
@@ -168,6 +233,9 @@ func (c *Collector) SetNextSleepDuration(sleepDuration time.Duration) {
 }
 
 // SetContext set context of collector
+//
+//	context is used for all cache operations and is passed to processors via Processor.Context()
+//	(values and cancellation are propagated into collect runs)
 func (c *Collector) SetContext(ctx context.Context) {
 	c.context = ctx
 }
@@ -177,6 +245,83 @@ func (c *Collector) GetContext() context.Context {
 	return c.context
 }
 
+// SetClock set clock function used for cache expiry calculations (defaults to time.Now)
+func (c *Collector) SetClock(clock func() time.Time) {
+	c.clock = clock
+}
+
+// SetCollectTimeout sets timeout for each collect run, on timeout the previous metrics are kept (0 disables timeout)
+//
+//	on timeout the context of the collect run is canceled (see Processor.Context) and the run returns immediately,
+//	metrics of the timed out run are discarded and collect runs are skipped until its Collect has returned
+//	timeout also bounds the cache restore and the cache save of the collect run
+func (c *Collector) SetCollectTimeout(timeout time.Duration) {
+	c.collectTimeout = timeout
+}
+
+// SetMaxSeries sets maximum number of samples (of all metric lists) per collect run, runs exceeding the limit are rejected
+// and the previous metrics are kept (0 disables limit)
+func (c *Collector) SetMaxSeries(maxSeries int) {
+	c.maxSeries = maxSeries
+}
+
+// SetMetricPrefix sets prefix for all metric names of metric lists (needs to be set before metric lists are registered)
+func (c *Collector) SetMetricPrefix(prefix string) error {
+	if prefix != "" && !metricPrefixRegexp.MatchString(prefix) {
+		return fmt.Errorf(`invalid metric prefix "%v", needs to match %v`, prefix, metricPrefixRegexp.String())
+	}
+
+	c.metricPrefix = prefix
+	return nil
+}
+
+// SetValueTransform sets hook for transforming metric values (eg. unit conversion) of metric lists
+//
+//	hook is called once per sample with metric name (without prefix) after each collect run,
+//	before metrics are exported and saved to cache (restored metrics are not transformed again)
+func (c *Collector) SetValueTransform(transform func(name string, value float64) float64) {
+	c.valueTransform = transform
+}
+
+// SetStaleMarking keeps series (of gauge metric lists with reset) which are not produced by the current run for the grace period,
+// they are emitted with their last value as separate metric <name>_stale (0 disables stale marking)
+func (c *Collector) SetStaleMarking(grace time.Duration) {
+	c.staleGrace = grace
+}
+
+// SetMaxLabelValueLength sets maximum length (characters) of label values of metric lists, longer values are truncated
+// and end with "…" (0 disables limit)
+//
+//	applies to exported and cached metrics, truncated values can result in duplicate series which are merged:
+//	gauges keep the last value, counters sum up the values and histograms and summaries observe all values
+func (c *Collector) SetMaxLabelValueLength(maxLength int) {
+	c.maxLabelValueLength = maxLength
+}
+
+// SetLogSampling enables log sampling, identical messages (level and message) are only logged once per interval and
+// afterwards every nth occurrence, dropped messages are counted in collector_log_messages_dropped (every <= 0 disables sampling)
+//
+//	avoids log flooding with repeated errors (eg. during Azure outages),
+//	also applies to loggers derived from the collector logger before sampling was enabled (eg. processor loggers)
+func (c *Collector) SetLogSampling(every int, per time.Duration) {
+	if c.logCore == nil {
+		return
+	}
+
+	if every <= 0 || per <= 0 {
+		c.logCore.sampling.setSampler(nil)
+		return
+	}
+
+	hook := zapcore.SamplerHook(func(entry zapcore.Entry, decision zapcore.SamplingDecision) {
+		if decision&zapcore.LogDropped > 0 {
+			metricLogDropped.WithLabelValues(c.Name).Inc()
+		}
+	})
+
+	c.logCore.sampling.setSampler(zapcore.NewSamplerWithOptions(c.logCore.Core, per, 1, every, hook))
+}
+
 // SetConcurrency set global concurrency for collector
 func (c *Collector) SetConcurrency(concurrency int) {
 	c.concurrency = concurrency
@@ -209,12 +354,53 @@ func (c *Collector) GetLastScapeTime() *time.Time {
 
 // GetNextScrapeTime returns next scrape time
 func (c *Collector) GetNextScrapeTime() *time.Time {
+	c.nextScrapeTimeLock.RLock()
+	defer c.nextScrapeTimeLock.RUnlock()
 	return c.nextScrapeTime
 }
 
+// setNextScrapeTime sets next scrape time
+func (c *Collector) setNextScrapeTime(nextScrapeTime *time.Time) {
+	c.nextScrapeTimeLock.Lock()
+	defer c.nextScrapeTimeLock.Unlock()
+	c.nextScrapeTime = nextScrapeTime
+}
+
+// NextScrapeTime returns time of the next collect run (zero time if unknown, eg. collector was not started yet)
+//
+//	includes cache based sleep duration (see SetNextSleepDuration) and uses cron schedule if cron is used
+func (c *Collector) NextScrapeTime() time.Time {
+	if c.cronSpec != nil {
+		if schedule, err := cron.Parse(*c.cronSpec); err == nil {
+			return schedule.Next(c.clock())
+		}
+	}
+
+	if nextScrapeTime := c.GetNextScrapeTime(); nextScrapeTime != nil {
+		return *nextScrapeTime
+	}
+
+	return time.Time{}
+}
+
 // backoffDuration returns the calculated backoff duration
 func (c *Collector) backoffDuration() *time.Duration {
-	if len(c.panic.backoff) == 0 {
+	if c.failureBackoff.base > 0 {
+		if c.failureBackoff.failures == 0 {
+			return nil
+		}
+
+		backoff := c.failureBackoff.base
+		for i := 1; i < c.failureBackoff.failures && backoff < c.failureBackoff.max; i++ {
+			backoff *= 2
+		}
+		if backoff > c.failureBackoff.max && c.failureBackoff.max > c.failureBackoff.base {
+			backoff = c.failureBackoff.max
+		}
+		return &backoff
+	}
+
+	if len(c.panic.backoff) == 0 || atomic.LoadInt64(&c.panic.counter) == 0 {
 		return nil
 	}
 
@@ -229,17 +415,32 @@ func (c *Collector) Start() error {
 		c.waitGroup = &wg
 	}
 
+	if c.cache != nil && c.cacheConfig.verifyWritable && !c.cacheConfig.readOnly {
+		if err := c.VerifyCacheWritable(c.context); err != nil {
+			return err
+		}
+	}
+
+	if c.cache != nil && c.cacheConfig.compactOnStart && !c.cacheConfig.readOnly {
+		if removed, err := c.CompactCache(c.context, 0); err == nil {
+			c.logger.Infof(`removed %v expired caches`, removed)
+		} else {
+			c.logger.Warnf(`unable to compact cache: %v`, err.Error())
+		}
+	}
+
 	if c.scrapeTime != nil {
 		// scrape time execution
 		go func() {
-			if c.cache != nil && c.runCacheRestore() {
+			if c.cache != nil && c.runCacheRestoreSerialized() {
+				sleepTime := c.scheduledSleepDuration()
 				c.logger.With(
 					zap.Float64("duration", c.lastScrapeDuration.Seconds()),
 					zap.Time("nextRun", c.nextScrapeTime.UTC()),
-				).Infof("finished cache restore, next run in %s", c.sleepTime.String())
+				).Infof("finished cache restore, next run in %s", sleepTime.String())
 
 				// wait until next run
-				time.Sleep(*c.sleepTime)
+				time.Sleep(sleepTime)
 			} else {
 				// randomize collector start times
 				startTimeOffset := float64(5)
@@ -253,7 +454,7 @@ func (c *Collector) Start() error {
 			// normal run, endless loop
 			for {
 				c.run()
-				time.Sleep(*c.sleepTime)
+				time.Sleep(c.scheduledSleepDuration())
 			}
 		}()
 	} else if c.cronSpec != nil {
@@ -263,10 +464,40 @@ func (c *Collector) Start() error {
 	return nil
 }
 
+// scheduledSleepDuration returns sleep duration until next scheduled run,
+// sleep duration is set by runs, so it waits for running runs (eg. CollectNow)
+func (c *Collector) scheduledSleepDuration() time.Duration {
+	release, _ := c.acquireRun(context.Background())
+	defer release()
+
+	return *c.sleepTime
+}
+
+// runCacheRestoreSerialized restores metrics from cache (see runCacheRestore) but waits for running collect runs (eg. CollectNow)
+func (c *Collector) runCacheRestoreSerialized() bool {
+	release, _ := c.acquireRun(context.Background())
+	defer release()
+
+	return c.runCacheRestore()
+}
+
 // runCacheRestore tries to restore metrics from cache and returns true if restore was successfull
-func (c *Collector) runCacheRestore() (result bool) {
+func (c *Collector) runCacheRestore() bool {
+	// cache restore is bounded by collect timeout
+	ctx, cancel := c.newCollectContext(c.context)
+	defer cancel()
+
+	return c.runRestore(func() bool {
+		return c.collectionRestoreCache(ctx)
+	})
+}
+
+// runRestore restores metrics using restore func and returns true if restore was successfull
+func (c *Collector) runRestore(restore func() bool) (result bool) {
 	// set next sleep duration (automatic calculation, can be overwritten by collect)
-	c.SetNextSleepDuration(*c.scrapeTime)
+	if c.scrapeTime != nil {
+		c.SetNextSleepDuration(*c.scrapeTime)
+	}
 
 	// cleanup internal metric lists (to ensure clean metric lists)
 	c.cleanupMetricLists()
@@ -275,7 +506,7 @@ func (c *Collector) runCacheRestore() (result bool) {
 	c.collectionStart()
 
 	result = false
-	if c.collectionRestoreCache() {
+	if restore() {
 		// metrics restored from cache, do not collect them but try to restore them
 		func() {
 			defer func() {
@@ -295,31 +526,135 @@ func (c *Collector) runCacheRestore() (result bool) {
 			}()
 
 			// try to restore metrics from cache
-			c.collectRun(false)
+			c.collectRun(c.context, false)
+			c.storeCacheSnapshot()
 			result = true
 		}()
 	}
 
+	if result {
+		metricScrapeSuccess.WithLabelValues(c.Name).Set(1)
+	}
+
 	return
 }
 
+// runCacheReplay only restores metrics from cache and skips collect if cache is not available (see CacheModeReplay)
+func (c *Collector) runCacheReplay() {
+	c.logger.Info("starting metrics cache replay")
+
+	if c.runCacheRestore() {
+		c.logger.With(
+			zap.Float64("duration", c.lastScrapeDuration.Seconds()),
+			zap.Time("nextRun", c.nextScrapeTime.UTC()),
+		).Infof("finished cache replay, next run in %s", c.sleepTime.String())
+		return
+	}
+
+	// no usable cache found, collect is not allowed in replay mode
+	c.cleanupMetricLists()
+	c.collectionFinish()
+	metricSuccess.WithLabelValues(c.Name).Set(0)
+	metricScrapeSuccess.WithLabelValues(c.Name).Set(0)
+	c.countError(errorStageCacheRead)
+	c.logger.With(
+		zap.Time("nextRun", c.nextScrapeTime.UTC()),
+	).Errorf("cache replay failed, no usable cache found and collect is skipped in replay mode, next run in %s", c.sleepTime.String())
+}
+
+// CollectNow triggers a collect run immediately (eg. on webhook), metrics and cache are updated as by scheduled runs,
+// waits for running runs as runs are serialized, returns an error if the collect run failed
+//
+//	collector needs to be started (see Start), schedule of the next runs (sleep duration and next scrape time) is not changed
+func (c *Collector) CollectNow(ctx context.Context) error {
+	if c.waitGroup == nil {
+		return fmt.Errorf(`collector "%v" is not started`, c.Name)
+	}
+
+	if c.cache != nil && c.cacheConfig.mode == CacheModeReplay {
+		return fmt.Errorf(`collect is not allowed in cache replay mode`)
+	}
+
+	release, err := c.acquireRun(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// keep schedule of scheduled runs (collect run sets sleep duration and next scrape time)
+	sleepTime, nextScrapeTime := c.sleepTime, c.GetNextScrapeTime()
+	defer func() {
+		c.sleepTime = sleepTime
+		c.setNextScrapeTime(nextScrapeTime)
+	}()
+
+	if !c.runCollect(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf(`collect run of collector "%v" failed`, c.Name)
+	}
+
+	return nil
+}
+
+// acquireRun waits until no other run is active (or ctx is done) and returns func to release the run
+func (c *Collector) acquireRun(ctx context.Context) (func(), error) {
+	select {
+	case c.runLock <- struct{}{}:
+		return func() { <-c.runLock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // run starts normal metrics run
 func (c *Collector) run() {
+	release, _ := c.acquireRun(context.Background())
+	defer release()
+
+	if c.cache != nil && c.cacheConfig.mode == CacheModeReplay {
+		c.runCacheReplay()
+		return
+	}
+
+	c.runCollect(c.context)
+}
+
+// runCollect collects metrics (with context derived from parent), updates cache and returns true if collect was successful
+func (c *Collector) runCollect(parent context.Context) bool {
 	c.logger.Info("starting metrics collection")
 
 	// set next sleep duration (automatic calculation, can be overwritten by collect)
 	c.SetNextSleepDuration(*c.scrapeTime)
 
+	// timed out collect run is still writing to the metric lists, keep previous metrics until it has returned
+	if c.collectPending() {
+		c.logger.Warn(`previous timed out collect run has not returned yet, skipping metrics collection and keeping previous metrics`)
+		return false
+	}
+
 	// cleanup internal metric lists (to ensure clean metric lists)
 	c.cleanupMetricLists()
 
 	// start collection
 	c.collectionStart()
 
+	// context of collect run, also used for saving the cache (cache write is bounded by collect timeout)
+	ctx, cancel := c.newCollectContext(parent)
+	defer cancel()
+
 	// metrics could not be restored from cache, start collect run
-	if c.collectRun(true) {
-		c.collectionSaveCache()
+	collectSuccess := c.collectRun(ctx, true)
+	if collectSuccess {
+		c.failureBackoff.failures = 0
+
+		// remember state of completed run as metric lists are cleaned up afterwards (see SaveCacheTo)
+		c.prepareCacheData()
+		c.storeCacheSnapshot()
+		c.collectionSaveCache(ctx)
 	} else {
+		c.failureBackoff.failures++
 		metricSuccess.WithLabelValues(c.Name).Set(0)
 		if backoffDuration := c.backoffDuration(); backoffDuration != nil {
 			c.logger.Warnf(`detected unsuccessful run, will retry next run in %v`, backoffDuration.String())
@@ -327,35 +662,52 @@ func (c *Collector) run() {
 		}
 	}
 
-	// cleanup internal metric lists (reduce memory load)
-	c.cleanupMetricLists()
+	// cleanup internal metric lists (reduce memory load), lists of a timed out run are cleaned by the next run
+	if !c.collectPending() {
+		c.cleanupMetricLists()
+	}
 
 	// finish run and calculate next run
 	c.collectionFinish()
 
+	if collectSuccess {
+		metricScrapeSuccess.WithLabelValues(c.Name).Set(1)
+	} else {
+		metricScrapeSuccess.WithLabelValues(c.Name).Set(0)
+	}
+
 	c.logger.With(
 		zap.Float64("duration", c.lastScrapeDuration.Seconds()),
 		zap.Time("nextRun", c.nextScrapeTime.UTC()),
 	).Infof("finished metrics collection, next run in %s", c.sleepTime.String())
+
+	return collectSuccess
 }
 
-// collectRun starts collector run and handles panics
-func (c *Collector) collectRun(doCollect bool) bool {
+// collectRun starts collector run (with context of run) and handles panics
+func (c *Collector) collectRun(ctx context.Context, doCollect bool) bool {
 	finished := false
 	var panicDetected bool
 	var callbackList []func()
 
 	if doCollect {
+		c.setRunContext(ctx)
+
 		callbackChannel := make(chan func())
+		collectDone := make(chan struct{})
+		c.collectDone = collectDone
 
 		go func() {
 			// catch panics and increase panic counter
 			// pass through panics after panic counter exceeds threshold
 			defer func() {
+				c.setRunContext(nil)
+				close(collectDone)
 				close(callbackChannel)
 
 				if !finished {
 					panicDetected = true
+					c.countError(errorStageCollect)
 					atomic.AddInt64(&c.panic.counter, 1)
 					metricPanicCount.WithLabelValues(c.Name).Inc()
 					panicCounter := atomic.LoadInt64(&c.panic.counter)
@@ -382,9 +734,46 @@ func (c *Collector) collectRun(doCollect bool) bool {
 			finished = true
 		}()
 
-		for callback := range callbackChannel {
-			callbackList = append(callbackList, callback)
+	callbackLoop:
+		for {
+			select {
+			case callback, ok := <-callbackChannel:
+				if !ok {
+					break callbackLoop
+				}
+				callbackList = append(callbackList, callback)
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					// collect run timed out, keep previous metrics
+					c.logger.Errorf(`collect run timed out after %v, keeping previous metrics`, c.collectTimeout.String())
+					metricCollectTimeout.WithLabelValues(c.Name).Inc()
+					c.countError(errorStageCollect)
+				} else {
+					c.logger.Warnf(`collect run canceled: %v`, ctx.Err())
+				}
+
+				// discard callbacks of the timed out run in background so its Collect can return
+				go func() {
+					for range callbackChannel {
+					}
+				}()
+
+				return false
+			}
+		}
+
+		if c.maxSeries > 0 {
+			if seriesCount := c.seriesCount(); seriesCount > c.maxSeries {
+				// cardinality limit exceeded, keep previous metrics
+				c.logger.Errorf(`collect run produced %v series which exceeds the limit of %v series, keeping previous metrics`, seriesCount, c.maxSeries)
+				c.countError(errorStageCollect)
+				return false
+			}
 		}
+
+		// transform values and truncate labels before metrics are set and cached
+		c.transformValues()
+		c.truncateLabelValues()
 	}
 
 	// ensure that metrics are written completely
@@ -411,19 +800,109 @@ func (c *Collector) collectRun(doCollect bool) bool {
 		case *prometheus.CounterVec:
 			metric.CounterAdd(vec)
 		}
+		metric.updateTimestamps()
+		if c.staleGrace > 0 {
+			metric.updateStaleSamples(c.clock(), c.staleGrace)
+		}
 	}
 
 	return finished
 }
 
-// resetMetrics calls processor reset and resets registered metrics (if reset is enabled)
+// collectPending returns true if Collect of a timed out collect run has not returned yet
+func (c *Collector) collectPending() bool {
+	if c.collectDone == nil {
+		return false
+	}
+
+	select {
+	case <-c.collectDone:
+		c.collectDone = nil
+		return false
+	default:
+		return true
+	}
+}
+
+// setRunContext sets context of the running collect (nil after Collect has returned)
+func (c *Collector) setRunContext(ctx context.Context) {
+	c.runContextLock.Lock()
+	defer c.runContextLock.Unlock()
+	c.runContext = ctx
+}
+
+// currentContext returns context of the running collect or the collector context
+func (c *Collector) currentContext() context.Context {
+	c.runContextLock.RLock()
+	defer c.runContextLock.RUnlock()
+	if c.runContext != nil {
+		return c.runContext
+	}
+	return c.context
+}
+
+// seriesCount returns number of samples of all metric lists
+func (c *Collector) seriesCount() int {
+	count := 0
+	for _, metric := range c.data.Metrics {
+		count += len(metric.GetList())
+	}
+	return count
+}
+
+// transformValues applies value transformation hook to all samples of metric lists
+func (c *Collector) transformValues() {
+	if c.valueTransform == nil {
+		return
+	}
+
+	for name, metric := range c.data.Metrics {
+		metricName := metric.metricName(name)
+		for num := range metric.List {
+			metric.List[num].Value = c.valueTransform(metricName, metric.List[num].Value)
+		}
+	}
+}
+
+// truncateLabelValues truncates label values of all samples of metric lists (see SetMaxLabelValueLength)
+func (c *Collector) truncateLabelValues() {
+	if c.maxLabelValueLength <= 0 {
+		return
+	}
+
+	for _, metric := range c.data.Metrics {
+		for num := range metric.List {
+			metric.List[num].Labels = truncateLabels(metric.List[num].Labels, c.maxLabelValueLength)
+		}
+	}
+}
+
+// countError increases error metric for stage
+func (c *Collector) countError(stage string) {
+	if c.cacheState.standalone {
+		return
+	}
+
+	metricErrors.WithLabelValues(c.Name, stage).Inc()
+}
+
+// newCollectContext returns context (derived from parent) for collect run (with timeout if set)
+func (c *Collector) newCollectContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if c.collectTimeout > 0 {
+		return context.WithTimeout(parent, c.collectTimeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+// resetMetrics calls processor reset and resets registered metrics (if reset is enabled or metric list is ephemeral)
 func (c *Collector) resetMetrics() {
 	// reset metric values
 	c.processor.Reset()
 
 	// reset first
 	for _, metric := range c.data.Metrics {
-		if metric.reset {
+		if metric.reset || metric.ephemeral {
 			switch vec := metric.vec.(type) {
 			case *prometheus.GaugeVec:
 				vec.Reset()
@@ -453,42 +932,102 @@ func (c *Collector) GetData(name string) interface{} {
 }
 
 // RegisterMetricList register new managed prometheus metric vec
+//
+//	metric descriptor only contains the metric type as name, help and label names are not available from the vec,
+//	use RegisterGaugeMetricList, RegisterCounterMetricList, RegisterHistogramMetricList or RegisterSummaryMetricList
+//	for full metric descriptor (needed for detection of changed metrics on cache restore)
 func (c *Collector) RegisterMetricList(name string, vec interface{}, reset bool) *MetricList {
-	c.data.Metrics[name] = &MetricList{
+	return c.registerMetricList(name, vec, newMetricDescFromVec(vec), reset)
+}
+
+// RegisterGaugeMetricList registers new managed prometheus gauge vec (see RegisterMetricList)
+func (c *Collector) RegisterGaugeMetricList(name string, opts prometheus.GaugeOpts, labels []string, reset bool) *MetricList {
+	return c.registerMetricList(name, prometheus.NewGaugeVec(opts, labels), newMetricDesc(MetricTypeGauge, prometheus.Opts(opts), labels), reset)
+}
+
+// RegisterCounterMetricList registers new managed prometheus counter vec (see RegisterMetricList)
+func (c *Collector) RegisterCounterMetricList(name string, opts prometheus.CounterOpts, labels []string, reset bool) *MetricList {
+	return c.registerMetricList(name, prometheus.NewCounterVec(opts, labels), newMetricDesc(MetricTypeCounter, prometheus.Opts(opts), labels), reset)
+}
+
+// RegisterHistogramMetricList registers new managed prometheus histogram vec (see RegisterMetricList)
+func (c *Collector) RegisterHistogramMetricList(name string, opts prometheus.HistogramOpts, labels []string, reset bool) *MetricList {
+	desc := newMetricDesc(MetricTypeHistogram, prometheus.Opts{Namespace: opts.Namespace, Subsystem: opts.Subsystem, Name: opts.Name, Help: opts.Help}, labels)
+	return c.registerMetricList(name, prometheus.NewHistogramVec(opts, labels), desc, reset)
+}
+
+// RegisterSummaryMetricList registers new managed prometheus summary vec (see RegisterMetricList)
+func (c *Collector) RegisterSummaryMetricList(name string, opts prometheus.SummaryOpts, labels []string, reset bool) *MetricList {
+	desc := newMetricDesc(MetricTypeSummary, prometheus.Opts{Namespace: opts.Namespace, Subsystem: opts.Subsystem, Name: opts.Name, Help: opts.Help}, labels)
+	return c.registerMetricList(name, prometheus.NewSummaryVec(opts, labels), desc, reset)
+}
+
+// registerMetricList registers metric vec with metric descriptor
+func (c *Collector) registerMetricList(name string, vec interface{}, desc *MetricDesc, reset bool) *MetricList {
+	metricList := &MetricList{
 		MetricList: prometheusCommon.NewMetricsList(),
+		Desc:       desc,
 		vec:        vec,
 		reset:      reset,
 	}
+	c.data.Metrics[name] = metricList
+
+	var collector prometheus.Collector
+	switch vec := vec.(type) {
+	case *prometheus.GaugeVec:
+		collector = vec
+	case *prometheus.HistogramVec:
+		collector = vec
+	case *prometheus.SummaryVec:
+		collector = vec
+	case *prometheus.CounterVec:
+		collector = vec
+	default:
+		panic(`not allowed prometheus metric vec found`)
+	}
 
+	// wrap metric vec to support explicit sample timestamps
+	metricCollector, err := newMetricListCollector(metricList, collector)
+	if err != nil && c.logger != nil {
+		c.logger.Warnf(`stale marking not available for metric list "%v": %v`, name, err)
+	}
+	metricList.fqName = metricCollector.fqName
+	metricList.variableLabels = metricCollector.variableLabels
+	collector = metricCollector
+
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
 	if c.registry != nil {
-		switch vec := vec.(type) {
-		case *prometheus.GaugeVec:
-			c.registry.MustRegister(vec)
-		case *prometheus.HistogramVec:
-			c.registry.MustRegister(vec)
-		case *prometheus.SummaryVec:
-			c.registry.MustRegister(vec)
-		case *prometheus.CounterVec:
-			c.registry.MustRegister(vec)
-		default:
-			panic(`not allowed prometheus metric vec found`)
-		}
-	} else {
-		switch vec := vec.(type) {
-		case *prometheus.GaugeVec:
-			prometheus.MustRegister(vec)
-		case *prometheus.HistogramVec:
-			prometheus.MustRegister(vec)
-		case *prometheus.SummaryVec:
-			prometheus.MustRegister(vec)
-		case *prometheus.CounterVec:
-			prometheus.MustRegister(vec)
-		default:
-			panic(`not allowed prometheus metric vec found`)
-		}
+		registerer = c.registry
 	}
 
-	return c.data.Metrics[name]
+	if c.metricPrefix != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(c.metricPrefix, registerer)
+	}
+
+	registerer.MustRegister(collector)
+
+	return metricList
+}
+
+// RegisterNativeHistogramMetricList registers new managed prometheus histogram vec with native histogram support
+//
+//	native histograms are only exposed using the protobuf exposition format (and if enabled in Prometheus),
+//	classic buckets (opts.Buckets or default buckets) are only exposed if native.ClassicBuckets is enabled
+func (c *Collector) RegisterNativeHistogramMetricList(name string, opts prometheus.HistogramOpts, labels []string, native NativeHistogramOpts, reset bool) *MetricList {
+	return c.RegisterMetricList(name, prometheus.NewHistogramVec(native.apply(opts), labels), reset)
+}
+
+// DeclareMetric declares and registers a managed gauge metric vec up front (metric descriptor is registered before first collect run)
+func (c *Collector) DeclareMetric(name string, help string, labels []string) *MetricList {
+	return c.RegisterGaugeMetricList(
+		name,
+		prometheus.GaugeOpts{
+			Name: name,
+			Help: help,
+		},
+		labels,
+		true,
+	)
 }
 
 // GetMetricList returns managed metric vec
@@ -496,6 +1035,16 @@ func (c *Collector) GetMetricList(name string) *MetricList {
 	return c.data.Metrics[name]
 }
 
+// MetricNames returns sorted names of all metrics (incl. metric prefix) managed by the registered metric lists
+func (c *Collector) MetricNames() []string {
+	names := make([]string, 0, len(c.data.Metrics))
+	for name, metric := range c.data.Metrics {
+		names = append(names, c.metricPrefix+metric.metricName(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
 // cleanupMetricLists resets all registered metric vec
 func (c *Collector) cleanupMetricLists() {
 	for _, metric := range c.data.Metrics {
@@ -505,7 +1054,7 @@ func (c *Collector) cleanupMetricLists() {
 
 // collectionStart processes collection start
 func (c *Collector) collectionStart() {
-	c.collectionStartTime = time.Now()
+	c.collectionStartTime = c.clock()
 	c.lastScrapeTime = nil
 }
 
@@ -515,11 +1064,14 @@ func (c *Collector) collectionFinish() {
 		c.lastScrapeTime = &c.collectionStartTime
 	}
 
-	duration := time.Since(c.collectionStartTime)
+	duration := c.clock().Sub(c.collectionStartTime)
 	c.lastScrapeDuration = &duration
 
-	nextScrapeTime := time.Now().Add(*c.sleepTime)
-	c.nextScrapeTime = &nextScrapeTime
+	// sleep time is not set if collector is not started (eg. RestoreCacheFrom without scrape time)
+	if c.sleepTime != nil {
+		nextScrapeTime := c.clock().Add(*c.sleepTime)
+		c.setNextScrapeTime(&nextScrapeTime)
+	}
 
 	metricDuration.WithLabelValues(c.Name).Set(c.lastScrapeDuration.Seconds())
 	metricSuccess.WithLabelValues(c.Name).Set(1)
@@ -0,0 +1,1109 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/remeh/sizedwaitgroup"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testProcessor struct {
+	Processor
+
+	collectCount int
+	collect      func(c *Collector)
+}
+
+func (p *testProcessor) Reset() {}
+
+func (p *testProcessor) Collect(callback chan<- func()) {
+	p.collectCount++
+	p.collect(p.Collector)
+}
+
+func newTestCollector(t *testing.T, cachePath string, collect func(c *Collector)) (*Collector, *testProcessor) {
+	t.Helper()
+
+	processor := &testProcessor{collect: collect}
+	c := New(t.Name(), processor, zap.NewNop().Sugar())
+	c.SetPrometheusRegistry(prometheus.NewRegistry())
+	c.SetScapeTime(1 * time.Hour)
+	c.SetCache(&cachePath, BuildCacheTag("test"))
+
+	wg := sizedwaitgroup.New(-1)
+	c.waitGroup = &wg
+
+	return c, processor
+}
+
+func registerTestMetrics(c *Collector) {
+	c.RegisterGaugeMetricList(
+		"gauge",
+		prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"},
+		[]string{"name"},
+		true,
+	)
+
+	c.RegisterCounterMetricList(
+		"counter",
+		prometheus.CounterOpts{Name: "test_counter", Help: "test counter"},
+		[]string{"name"},
+		true,
+	)
+
+	c.RegisterHistogramMetricList(
+		"histogram",
+		prometheus.HistogramOpts{Name: "test_histogram", Help: "test histogram", Buckets: []float64{1, 5, 10}},
+		[]string{"name"},
+		true,
+	)
+
+	c.RegisterSummaryMetricList(
+		"summary",
+		prometheus.SummaryOpts{Name: "test_summary", Help: "test summary", Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01}},
+		[]string{"name"},
+		true,
+	)
+}
+
+func collectTestMetrics(c *Collector) {
+	c.GetMetricList("gauge").Add(prometheus.Labels{"name": "foo"}, 42)
+	c.GetMetricList("counter").Add(prometheus.Labels{"name": "foo"}, 3)
+	for _, val := range []float64{0.5, 2, 3, 7, 12, 20} {
+		c.GetMetricList("histogram").Add(prometheus.Labels{"name": "foo"}, val)
+		c.GetMetricList("summary").Add(prometheus.Labels{"name": "foo"}, val)
+	}
+}
+
+func gatherTestMetrics(t *testing.T, c *Collector) []byte {
+	t.Helper()
+
+	families, err := c.GetPrometheusRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// writeTestCache runs a collector which writes the cache, returns cache path and collector
+func writeTestCache(t *testing.T, collect func(c *Collector)) (string, *Collector) {
+	t.Helper()
+
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	c, _ := newTestCollector(t, cachePath, collect)
+	registerTestMetrics(c)
+	c.run()
+
+	return cachePath, c
+}
+
+func Test_CollectorCacheRestore(t *testing.T) {
+	cachePath, writer := writeTestCache(t, collectTestMetrics)
+	expected := gatherTestMetrics(t, writer)
+
+	testCases := []struct {
+		name     string
+		setup    func(c *Collector)
+		register func(c *Collector)
+		restored bool
+		check    func(t *testing.T, c *Collector)
+	}{
+		{
+			name:     "values",
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+					t.Fatalf(`expected restored metric value 42, got %v`, val)
+				}
+			},
+		},
+		{
+			name:     "metric types",
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				for _, name := range []string{"test_gauge", "test_counter", "test_histogram", "test_summary"} {
+					if err := testutil.GatherAndCompare(c.GetPrometheusRegistry(), bytes.NewReader(expected), name); err != nil {
+						t.Errorf(`restored metric "%s" differs from collected metric: %v`, name, err)
+					}
+				}
+			},
+		},
+		{
+			name:     "metric descriptor",
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				desc := c.GetMetricList("histogram").Desc
+				if desc == nil || desc.Name != "test_histogram" || desc.Help != "test histogram" || desc.Type != MetricTypeHistogram || strings.Join(desc.Labels, ",") != "name" {
+					t.Fatalf(`unexpected metric descriptor: %+v`, desc)
+				}
+			},
+		},
+		{
+			name: "different metric type",
+			register: func(c *Collector) {
+				c.RegisterMetricList("gauge", prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_gauge", Help: "test gauge"}, []string{"name"}), true)
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.CounterVec).WithLabelValues("foo")); val != 0 {
+					t.Fatalf(`expected cached metric with different type to be ignored, got value %v`, val)
+				}
+			},
+		},
+		{
+			name: "different label names",
+			register: func(c *Collector) {
+				c.RegisterGaugeMetricList("gauge", prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"}, []string{"name", "location"}, true)
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo", "")); val != 0 {
+					t.Fatalf(`expected cached metric with different label names to be ignored, got value %v`, val)
+				}
+			},
+		},
+		{
+			name: "tag mismatch",
+			setup: func(c *Collector) {
+				c.SetCache(&cachePath, BuildCacheTag("test-v2"))
+			},
+			restored: false,
+		},
+		{
+			name: "previous tag",
+			setup: func(c *Collector) {
+				c.SetCache(&cachePath, BuildCacheTag("test-v2"))
+				c.SetCacheAcceptPreviousTag(*BuildCacheTag("test"))
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if *c.sleepTime != 0 {
+					t.Fatalf(`expected immediate collect run after restore with previous tag, got sleep time %v`, c.sleepTime.String())
+				}
+			},
+		},
+		{
+			name: "read-only",
+			setup: func(c *Collector) {
+				c.SetCacheReadOnly(true)
+			},
+			restored: true,
+		},
+		{
+			name: "ephemeral metric list",
+			register: func(c *Collector) {
+				registerTestMetrics(c)
+				c.GetMetricList("gauge").SetEphemeral(true)
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if count := testutil.CollectAndCount(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec)); count != 0 {
+					t.Fatalf(`expected no restored series for ephemeral metric list, got %v`, count)
+				}
+				if val := testutil.ToFloat64(c.GetMetricList("counter").vec.(*prometheus.CounterVec).WithLabelValues("foo")); val != 3 {
+					t.Fatalf(`expected restored counter value 3, got %v`, val)
+				}
+			},
+		},
+		{
+			// cache contains transformed values, restore must not transform again
+			name: "value transform",
+			setup: func(c *Collector) {
+				c.SetValueTransform(func(name string, value float64) float64 {
+					return value * 2
+				})
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+					t.Fatalf(`expected restored metric value 42, got %v`, val)
+				}
+			},
+		},
+		{
+			name: "cache age",
+			setup: func(c *Collector) {
+				c.clock = func() time.Time { return time.Now().Add(10 * time.Minute) }
+			},
+			restored: true,
+			check: func(t *testing.T, c *Collector) {
+				metric := dto.Metric{}
+				if err := metricCacheRestoreAge.WithLabelValues(c.Name).(prometheus.Histogram).Write(&metric); err != nil {
+					t.Fatal(err)
+				}
+				if count := metric.GetHistogram().GetSampleCount(); count != 1 {
+					t.Fatalf(`expected 1 cache age observation, got %v`, count)
+				}
+				if sum := metric.GetHistogram().GetSampleSum(); sum < 600 || sum > 660 {
+					t.Fatalf(`expected cache age of about 600 seconds, got %v`, sum)
+				}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			c, processor := newTestCollector(t, cachePath, collectTestMetrics)
+			if testCase.setup != nil {
+				testCase.setup(c)
+			}
+			if testCase.register != nil {
+				testCase.register(c)
+			} else {
+				registerTestMetrics(c)
+			}
+
+			if restored := c.runCacheRestore(); restored != testCase.restored {
+				t.Fatalf(`expected cache restore result %v, got %v`, testCase.restored, restored)
+			}
+			if processor.collectCount != 0 {
+				t.Fatalf(`expected collect not to be called on cache restore, got %v calls`, processor.collectCount)
+			}
+
+			if testCase.check != nil {
+				testCase.check(t, c)
+			}
+		})
+	}
+}
+
+func Test_CollectorCacheReplayMode(t *testing.T) {
+	cachePath, _ := writeTestCache(t, collectTestMetrics)
+
+	testCases := []struct {
+		name      string
+		cachePath string
+		setup     func(c *Collector)
+		value     float64
+		sleepTime func(sleepTime time.Duration) bool
+	}{
+		{
+			name:      "without cache",
+			cachePath: filepath.Join(t.TempDir(), "missing.json"),
+		},
+		{
+			name:      "with cache",
+			cachePath: cachePath,
+			value:     42,
+		},
+		{
+			// expiry and min remaining time are ignored, scrape time is used as sleep time
+			name:      "expired cache",
+			cachePath: cachePath,
+			setup: func(c *Collector) {
+				c.SetCacheMinRemaining(30 * time.Minute)
+				c.SetClock(func() time.Time {
+					return time.Now().Add(24 * time.Hour)
+				})
+			},
+			value:     42,
+			sleepTime: func(sleepTime time.Duration) bool { return sleepTime == 1*time.Hour },
+		},
+		{
+			// previous tag must not trigger an immediate rerun (collect is skipped in replay mode)
+			name:      "previous tag",
+			cachePath: cachePath,
+			setup: func(c *Collector) {
+				c.SetCache(&cachePath, BuildCacheTag("test-v2"))
+				c.SetCacheAcceptPreviousTag(*BuildCacheTag("test"))
+			},
+			value:     42,
+			sleepTime: func(sleepTime time.Duration) bool { return sleepTime > 0 },
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			c, processor := newTestCollector(t, testCase.cachePath, collectTestMetrics)
+			c.SetCacheMode(CacheModeReplay)
+			if testCase.setup != nil {
+				testCase.setup(c)
+			}
+			registerTestMetrics(c)
+			c.run()
+
+			if processor.collectCount != 0 {
+				t.Fatalf(`expected collect to be skipped in replay mode, got %v calls`, processor.collectCount)
+			}
+			if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != testCase.value {
+				t.Fatalf(`expected replayed metric value %v, got %v`, testCase.value, val)
+			}
+			if testCase.sleepTime != nil && !testCase.sleepTime(*c.sleepTime) {
+				t.Fatalf(`unexpected sleep time %v`, c.sleepTime.String())
+			}
+		})
+	}
+}
+
+func Test_CollectorCollectTimeout(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	timeout := false
+	release := make(chan struct{})
+	var timeoutCollectCount int32
+	collect := func(c *Collector) {
+		if !timeout {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": "foo"}, 42)
+			return
+		}
+
+		// collector which ignores the canceled context and returns late
+		atomic.AddInt32(&timeoutCollectCount, 1)
+		<-c.currentContext().Done()
+		<-release
+		c.GetMetricList("gauge").Add(prometheus.Labels{"name": "late"}, 1)
+	}
+
+	c, _ := newTestCollector(t, cachePath, collect)
+	registerTestMetrics(c)
+	c.SetCollectTimeout(50 * time.Millisecond)
+	c.run()
+	gauge := c.GetMetricList("gauge").vec.(*prometheus.GaugeVec)
+
+	timeout = true
+	start := time.Now()
+	c.run()
+	if duration := time.Since(start); duration > 1*time.Second {
+		t.Fatalf(`expected timed out run to return immediately, took %v`, duration)
+	}
+	if count := testutil.CollectAndCount(gauge); count != 1 {
+		t.Fatalf(`expected previous metrics (1 series) to be kept, got %v series`, count)
+	}
+	if val := testutil.ToFloat64(gauge.WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected previous metric value 42, got %v`, val)
+	}
+
+	// timed out collect has not returned yet, run is skipped
+	c.run()
+	if count := atomic.LoadInt32(&timeoutCollectCount); count != 1 {
+		t.Fatalf(`expected collect to be skipped while timed out collect is running, got %v calls`, count)
+	}
+
+	close(release)
+	for i := 0; c.collectPending(); i++ {
+		if i > 100 {
+			t.Fatalf(`expected timed out collect to return`)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx := c.currentContext(); ctx != c.context {
+		t.Fatalf(`expected context of collect run to be cleared after collect returned`)
+	}
+
+	// metrics of the timed out collect are discarded by the next run
+	timeout = false
+	c.run()
+	if count := testutil.CollectAndCount(gauge); count != 1 {
+		t.Fatalf(`expected metrics of timed out run to be discarded, got %v series`, count)
+	}
+	if val := testutil.ToFloat64(gauge.WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected metric value 42, got %v`, val)
+	}
+}
+
+func Test_CollectorNextScrapeTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+	registerTestMetrics(c)
+	c.SetClock(func() time.Time {
+		return now
+	})
+	if next := c.NextScrapeTime(); !next.IsZero() {
+		t.Fatalf(`expected zero next scrape time before first run, got %v`, next)
+	}
+
+	// next scrape time is read while collector runs (run with -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.NextScrapeTime()
+		}
+	}()
+	c.run()
+	<-done
+
+	if next := c.NextScrapeTime(); !next.Equal(now.Add(1 * time.Hour)) {
+		t.Fatalf(`expected next scrape time %v, got %v`, now.Add(1*time.Hour), next)
+	}
+}
+
+func Test_CollectorMaxSeries(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	value := float64(42)
+	seriesCount := 1
+	collect := func(c *Collector) {
+		for i := 0; i < seriesCount; i++ {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": fmt.Sprintf("foo%d", i)}, value)
+		}
+	}
+
+	c, _ := newTestCollector(t, cachePath, collect)
+	registerTestMetrics(c)
+	c.SetMaxSeries(2)
+	c.run()
+
+	gauge := c.GetMetricList("gauge").vec.(*prometheus.GaugeVec)
+	if val := testutil.ToFloat64(gauge.WithLabelValues("foo0")); val != 42 {
+		t.Fatalf(`expected metric value 42, got %v`, val)
+	}
+	if val := testutil.ToFloat64(metricScrapeSuccess.WithLabelValues(c.Name)); val != 1 {
+		t.Fatalf(`expected scrape success 1, got %v`, val)
+	}
+
+	// run exceeding series limit, previous metrics are kept
+	value = 10
+	seriesCount = 3
+	c.run()
+	if val := testutil.ToFloat64(metricScrapeSuccess.WithLabelValues(c.Name)); val != 0 {
+		t.Fatalf(`expected scrape success 0 for failed run, got %v`, val)
+	}
+	if count := testutil.CollectAndCount(gauge); count != 1 {
+		t.Fatalf(`expected previous metrics (1 series) to be kept, got %v series`, count)
+	}
+	if val := testutil.ToFloat64(gauge.WithLabelValues("foo0")); val != 42 {
+		t.Fatalf(`expected previous metric value 42, got %v`, val)
+	}
+}
+
+func Test_CollectorCacheSaveToRestoreFrom(t *testing.T) {
+	c1, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+	registerTestMetrics(c1)
+	c1.run()
+	if err := c1.SaveCacheTo(&bytes.Buffer{}); err == nil {
+		t.Fatalf(`expected error for collector without enabled cache snapshot`)
+	}
+
+	c1.SetCacheSnapshot(true)
+	if err := c1.SaveCacheTo(&bytes.Buffer{}); err == nil {
+		t.Fatalf(`expected error for collector without completed run`)
+	}
+
+	// metric lists are cleaned up after run, state of the completed run is saved
+	c1.run()
+	buf := bytes.Buffer{}
+	if err := c1.SaveCacheTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	c2, processor2 := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+	registerTestMetrics(c2)
+	c2.SetCacheSnapshot(true)
+	if val := testutil.ToFloat64(metricScrapeSuccess.WithLabelValues(c2.Name)); val != 0 {
+		t.Fatalf(`expected initial scrape success 0, got %v`, val)
+	}
+	if err := c2.RestoreCacheFrom(&buf); err != nil {
+		t.Fatalf(`expected restore to be successful, got: %v`, err)
+	}
+	if val := testutil.ToFloat64(metricScrapeSuccess.WithLabelValues(c2.Name)); val != 1 {
+		t.Fatalf(`expected scrape success 1 after restore, got %v`, val)
+	}
+	if processor2.collectCount != 0 {
+		t.Fatalf(`expected collect not to be called, got %v calls`, processor2.collectCount)
+	}
+	if val := testutil.ToFloat64(c2.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected restored metric value 42, got %v`, val)
+	}
+
+	// restored state can be saved again
+	buf.Reset()
+	if err := c2.SaveCacheTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// collector without scrape time (not started)
+	c3 := New(t.Name()+"_unstarted", &testProcessor{collect: collectTestMetrics}, zap.NewNop().Sugar())
+	c3.SetPrometheusRegistry(prometheus.NewRegistry())
+	registerTestMetrics(c3)
+	if err := c3.RestoreCacheFrom(&buf); err != nil {
+		t.Fatalf(`expected restore of saved restored state to be successful, got: %v`, err)
+	}
+	if val := testutil.ToFloat64(c3.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected restored metric value 42, got %v`, val)
+	}
+
+	if err := c2.RestoreCacheFrom(strings.NewReader("invalid")); err == nil {
+		t.Fatalf(`expected error for invalid cache content`)
+	}
+}
+
+func Test_CollectorCacheRestoreTimestamps(t *testing.T) {
+	timestamp := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	cachePath, _ := writeTestCache(t, func(c *Collector) {
+		c.GetMetricList("gauge").AddWithTimestamp(prometheus.Labels{"name": "foo"}, 42, timestamp)
+		c.GetMetricList("gauge").Add(prometheus.Labels{"name": "bar"}, 1)
+	})
+
+	c, _ := newTestCollector(t, cachePath, collectTestMetrics)
+	registerTestMetrics(c)
+	if !c.runCacheRestore() {
+		t.Fatalf(`expected cache restore to be successful`)
+	}
+
+	families, err := c.GetPrometheusRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "test_gauge" {
+			continue
+		}
+
+		for _, metric := range family.Metric {
+			switch metric.Label[0].GetValue() {
+			case "foo":
+				if metric.GetTimestampMs() != timestamp.UnixMilli() {
+					t.Errorf(`expected timestamp %v, got %v`, timestamp.UnixMilli(), metric.GetTimestampMs())
+				}
+			case "bar":
+				if metric.TimestampMs != nil {
+					t.Errorf(`expected no timestamp, got %v`, metric.GetTimestampMs())
+				}
+			}
+		}
+	}
+}
+
+func Test_CollectorCacheRestoreJitter(t *testing.T) {
+	cachePath, _ := writeTestCache(t, collectTestMetrics)
+
+	// replicas restoring the same cache get different sleep times
+	sleepTimes := []time.Duration{}
+	for i := 0; i < 2; i++ {
+		c, _ := newTestCollector(t, cachePath, collectTestMetrics)
+		c.SetScapeTime(3 * time.Hour)
+		c.SetCacheExpiryJitter(30 * time.Minute)
+		registerTestMetrics(c)
+		if !c.runCacheRestore() {
+			t.Fatalf(`expected cache restore to be successful`)
+		}
+
+		if *c.sleepTime < 1*time.Hour || *c.sleepTime > 1*time.Hour+31*time.Minute {
+			t.Fatalf(`expected sleep time between 1h and 1h31m, got %v`, c.sleepTime.String())
+		}
+		sleepTimes = append(sleepTimes, *c.sleepTime)
+	}
+
+	if sleepTimes[0] == sleepTimes[1] {
+		t.Fatalf(`expected different sleep times after restore of the same cache, got %v`, sleepTimes)
+	}
+}
+
+func Test_CollectorTimestampsConstLabels(t *testing.T) {
+	timestamp := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	rows := map[string]*time.Time{"foo": &timestamp, "bar": &timestamp}
+	collect := func(c *Collector) {
+		for name, rowTimestamp := range rows {
+			if rowTimestamp != nil {
+				c.GetMetricList("gauge").AddWithTimestamp(prometheus.Labels{"name": name}, 42, *rowTimestamp)
+			} else {
+				c.GetMetricList("gauge").Add(prometheus.Labels{"name": name}, 42)
+			}
+		}
+	}
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge", ConstLabels: prometheus.Labels{"env": "test"}}, []string{"name"})
+	metricList := c.RegisterMetricList("gauge", vec, false)
+
+	timestamps := func() map[string]int64 {
+		families, err := c.GetPrometheusRegistry().Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ret := map[string]int64{}
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "name" {
+						ret[label.GetValue()] = metric.GetTimestampMs()
+					}
+				}
+			}
+		}
+		return ret
+	}
+
+	c.run()
+	if ret := timestamps(); ret["foo"] != timestamp.UnixMilli() || ret["bar"] != timestamp.UnixMilli() {
+		t.Fatalf(`expected timestamp %v for metric with const labels, got %v`, timestamp.UnixMilli(), ret)
+	}
+
+	// foo is replaced by sample without timestamp, bar is kept in vec (without reset)
+	rows = map[string]*time.Time{"foo": nil}
+	c.run()
+	if ret := timestamps(); ret["foo"] != 0 || ret["bar"] != timestamp.UnixMilli() {
+		t.Fatalf(`expected timestamp only for kept series bar, got %v`, ret)
+	}
+
+	// timestamps of series removed from vec are removed
+	vec.DeleteLabelValues("bar")
+	c.run()
+	if count := len(metricList.getTimestamps()); count != 0 {
+		t.Fatalf(`expected no timestamps, got %v`, count)
+	}
+}
+
+func Test_CollectorMetricPrefix(t *testing.T) {
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+
+	if err := c.SetMetricPrefix("invalid-prefix"); err == nil {
+		t.Fatalf(`expected error for invalid metric prefix`)
+	}
+
+	if err := c.SetMetricPrefix("azure_"); err != nil {
+		t.Fatal(err)
+	}
+
+	registerTestMetrics(c)
+	c.run()
+
+	output := string(gatherTestMetrics(t, c))
+	if !strings.Contains(output, "azure_test_gauge{name=\"foo\"} 42") {
+		t.Fatalf(`expected prefixed metric in output, got: %v`, output)
+	}
+}
+
+func Test_CollectorCacheReadOnly(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	c, _ := newTestCollector(t, cachePath, collectTestMetrics)
+	c.SetCacheReadOnly(true)
+	registerTestMetrics(c)
+	c.run()
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Fatalf(`expected cache not to be written in read-only mode`)
+	}
+}
+
+func Test_CollectorValueTransform(t *testing.T) {
+	transformCount := 0
+	transform := func(name string, value float64) float64 {
+		transformCount++
+		if name == "test_gauge" {
+			return value / 2
+		}
+		return value
+	}
+
+	collect := func(c *Collector) {
+		c.GetMetricList("gauge").Add(prometheus.Labels{"name": "foo"}, 42)
+	}
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	c.SetValueTransform(transform)
+	registerTestMetrics(c)
+	c.run()
+	if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 21 {
+		t.Fatalf(`expected transformed metric value 21, got %v`, val)
+	}
+	if transformCount != 1 {
+		t.Fatalf(`expected transform to be called once, got %v calls`, transformCount)
+	}
+}
+
+func Test_CollectorValueTransformMetricVec(t *testing.T) {
+	names := []string{}
+	transform := func(name string, value float64) float64 {
+		names = append(names, name)
+		return value * 2
+	}
+
+	collect := func(c *Collector) {
+		c.GetMetricList("gauge").Add(prometheus.Labels{"name": "foo"}, 21)
+	}
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	c.SetValueTransform(transform)
+	c.RegisterMetricList("gauge", prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: "test", Name: "vec_gauge", Help: "test gauge"}, []string{"name"}), true)
+	c.run()
+
+	if len(names) != 1 || names[0] != "test_vec_gauge" {
+		t.Fatalf(`expected transform to be called with metric name "test_vec_gauge", got %v`, names)
+	}
+	if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected transformed metric value 42, got %v`, val)
+	}
+}
+
+func Test_CollectorCacheValuePrecision(t *testing.T) {
+	values := []float64{
+		0,
+		0.1,
+		1e-300,
+		9007199254740992,    // 2^53
+		9007199254740993,    // 2^53+1 (not representable as float64, same float64 as 2^53)
+		1152921504606846976, // 2^60
+		123456789012345.678,
+		1.7976931348623157e308,
+		-42.5,
+	}
+
+	collect := func(c *Collector) {
+		for num, value := range values {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": fmt.Sprintf("value%d", num)}, value)
+		}
+	}
+
+	c1, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	c1.SetCacheSnapshot(true)
+	registerTestMetrics(c1)
+	c1.run()
+	buf := bytes.Buffer{}
+	if err := c1.SaveCacheTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	c2, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	registerTestMetrics(c2)
+	if err := c2.RestoreCacheFrom(&buf); err != nil {
+		t.Fatalf(`expected restore to be successful, got: %v`, err)
+	}
+
+	gauge := c2.GetMetricList("gauge").vec.(*prometheus.GaugeVec)
+	for num, value := range values {
+		if val := testutil.ToFloat64(gauge.WithLabelValues(fmt.Sprintf("value%d", num))); val != value {
+			t.Fatalf(`expected restored value %v, got %v`, value, val)
+		}
+	}
+}
+
+func Test_CollectorFailureBackoff(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	seriesCount := 3
+	collect := func(c *Collector) {
+		for i := 0; i < seriesCount; i++ {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": fmt.Sprintf("foo%d", i)}, 1)
+		}
+	}
+
+	c, _ := newTestCollector(t, cachePath, collect)
+	registerTestMetrics(c)
+	c.SetMaxSeries(2)
+	c.SetFailureBackoff(1*time.Minute, 5*time.Minute)
+
+	// failed runs (exceeding series limit)
+	for _, expected := range []time.Duration{1 * time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		c.run()
+		if *c.sleepTime != expected {
+			t.Fatalf(`expected backoff sleep time %v, got %v`, expected.String(), c.sleepTime.String())
+		}
+	}
+
+	// successful run resets backoff
+	seriesCount = 1
+	c.run()
+	if *c.sleepTime != 1*time.Hour {
+		t.Fatalf(`expected scrape time as sleep time after successful run, got %v`, c.sleepTime.String())
+	}
+
+	seriesCount = 3
+	c.run()
+	if *c.sleepTime != 1*time.Minute {
+		t.Fatalf(`expected reset backoff sleep time 1m, got %v`, c.sleepTime.String())
+	}
+}
+
+func Test_CollectorStaleMarking(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	names := []string{"foo", "bar"}
+	collect := func(c *Collector) {
+		for _, name := range names {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": name}, 42)
+		}
+	}
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCollector(t, cachePath, collect)
+	c.SetPrometheusRegistry(prometheus.NewPedanticRegistry())
+	c.clock = func() time.Time { return now }
+	c.SetStaleMarking(10 * time.Minute)
+	registerTestMetrics(c)
+	c.run()
+
+	// bar disappears, still emitted as stale series within grace period
+	names = []string{"foo"}
+	now = now.Add(5 * time.Minute)
+	c.run()
+
+	output := string(gatherTestMetrics(t, c))
+	if !strings.Contains(output, `test_gauge{name="foo"} 42`) {
+		t.Fatalf(`expected current series in output, got: %v`, output)
+	}
+	if !strings.Contains(output, `test_gauge_stale{name="bar"} 42`) {
+		t.Fatalf(`expected stale series in output, got: %v`, output)
+	}
+	if strings.Contains(output, `test_gauge_stale{name="foo"}`) || strings.Contains(output, `test_gauge{name="bar"}`) {
+		t.Fatalf(`expected current series not to be stale, got: %v`, output)
+	}
+
+	// grace period elapsed
+	now = now.Add(10 * time.Minute)
+	c.run()
+
+	output = string(gatherTestMetrics(t, c))
+	if strings.Contains(output, `name="bar"`) {
+		t.Fatalf(`expected stale series to be removed after grace period, got: %v`, output)
+	}
+}
+
+func Test_CollectorStaleMarkingMetricVec(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	names := []string{"foo", "bar"}
+	collect := func(c *Collector) {
+		for _, name := range names {
+			c.GetMetricList("gauge").Add(prometheus.Labels{"name": name}, 42)
+		}
+	}
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCollector(t, cachePath, collect)
+	c.SetPrometheusRegistry(prometheus.NewPedanticRegistry())
+	c.clock = func() time.Time { return now }
+	c.SetStaleMarking(10 * time.Minute)
+	c.RegisterMetricList(
+		"gauge",
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "test \"gauge\"", ConstLabels: prometheus.Labels{"env": "test"}}, []string{"name"}),
+		true,
+	)
+	c.run()
+
+	// bar disappears, still emitted as stale series (with const labels) within grace period
+	names = []string{"foo"}
+	now = now.Add(5 * time.Minute)
+	c.run()
+
+	output := string(gatherTestMetrics(t, c))
+	if !strings.Contains(output, `test_gauge{env="test",name="foo"} 42`) {
+		t.Fatalf(`expected current series in output, got: %v`, output)
+	}
+	if !strings.Contains(output, `test_gauge_stale{env="test",name="bar"} 42`) {
+		t.Fatalf(`expected stale series in output, got: %v`, output)
+	}
+}
+
+func Test_CollectorNativeHistogram(t *testing.T) {
+	collect := func(c *Collector) {
+		for _, val := range []float64{0.5, 2, 3, 7, 12, 20} {
+			c.GetMetricList("native").Add(prometheus.Labels{"name": "foo"}, val)
+			c.GetMetricList("native_classic").Add(prometheus.Labels{"name": "foo"}, val)
+		}
+	}
+
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collect)
+	c.RegisterNativeHistogramMetricList("native", prometheus.HistogramOpts{Name: "test_native", Help: "test native histogram"}, []string{"name"}, NativeHistogramOpts{}, true)
+	c.RegisterNativeHistogramMetricList("native_classic", prometheus.HistogramOpts{Name: "test_native_classic", Help: "test native histogram", Buckets: []float64{1, 5, 10}}, []string{"name"}, NativeHistogramOpts{ClassicBuckets: true}, true)
+	c.run()
+
+	families, err := c.GetPrometheusRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedClassicBuckets := map[string]int{
+		"test_native":         0,
+		"test_native_classic": 3,
+	}
+	for _, family := range families {
+		expected, exists := expectedClassicBuckets[family.GetName()]
+		if !exists {
+			continue
+		}
+		delete(expectedClassicBuckets, family.GetName())
+
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleCount() != 6 {
+			t.Fatalf(`expected 6 samples for "%v", got %v`, family.GetName(), histogram.GetSampleCount())
+		}
+		if histogram.Schema == nil {
+			t.Fatalf(`expected native histogram schema for "%v"`, family.GetName())
+		}
+		if len(histogram.GetBucket()) != expected {
+			t.Fatalf(`expected %v classic buckets for "%v", got %v`, expected, family.GetName(), len(histogram.GetBucket()))
+		}
+	}
+
+	if len(expectedClassicBuckets) != 0 {
+		t.Fatalf(`expected histograms not found: %v`, expectedClassicBuckets)
+	}
+}
+
+func Test_CollectorMetricNames(t *testing.T) {
+	c, _ := newTestCollector(t, filepath.Join(t.TempDir(), "cache.json"), collectTestMetrics)
+	if err := c.SetMetricPrefix("azure_"); err != nil {
+		t.Fatal(err)
+	}
+	registerTestMetrics(c)
+
+	expected := []string{"azure_test_counter", "azure_test_gauge", "azure_test_histogram", "azure_test_summary"}
+	if names := c.MetricNames(); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf(`expected metric names %v, got %v`, expected, names)
+	}
+}
+
+func Test_CollectorLogSampling(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	c := New(t.Name(), &testProcessor{}, zap.New(core).Sugar())
+
+	// logger derived before sampling is enabled (eg. stored by processor)
+	processorLogger := c.logger.With(zap.String("subscriptionID", "foo"))
+
+	c.SetLogSampling(100, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		c.logger.Error(`unable to collect metrics`)
+	}
+	c.logger.Error(`unable to save cache`)
+
+	if count := logs.Len(); count != 2 {
+		t.Fatalf(`expected 2 logged messages, got %v`, count)
+	}
+	if val := testutil.ToFloat64(metricLogDropped.WithLabelValues(c.Name)); val != 9 {
+		t.Fatalf(`expected 9 dropped messages, got %v`, val)
+	}
+
+	for i := 0; i < 10; i++ {
+		processorLogger.Error(`unable to fetch resources`)
+	}
+	if count := logs.Len(); count != 3 {
+		t.Fatalf(`expected 3 logged messages, got %v`, count)
+	}
+	if fields := logs.All()[2].ContextMap(); fields["subscriptionID"] != "foo" || fields["collector"] != c.Name {
+		t.Fatalf(`expected fields of derived logger, got %v`, fields)
+	}
+
+	// disable sampling
+	c.SetLogSampling(0, 0)
+	for i := 0; i < 10; i++ {
+		c.logger.Error(`unable to collect metrics`)
+	}
+
+	if count := logs.Len(); count != 13 {
+		t.Fatalf(`expected 13 logged messages, got %v`, count)
+	}
+}
+
+func Test_CollectorEphemeralMetricList(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	c, _ := newTestCollector(t, cachePath, collectTestMetrics)
+	registerTestMetrics(c)
+	c.GetMetricList("gauge").SetEphemeral(true)
+	c.run()
+
+	if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected collected metric value 42, got %v`, val)
+	}
+
+	content, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := ParseCollectorData(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := view.Metrics()["gauge"]; exists {
+		t.Fatalf(`expected ephemeral metric list not to be stored in cache`)
+	}
+	if _, exists := view.Metrics()["counter"]; !exists {
+		t.Fatalf(`expected metric list "counter" to be stored in cache`)
+	}
+}
+
+func Test_CollectorCollectNow(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	notStarted := New(t.Name()+"_notstarted", &testProcessor{}, zap.NewNop().Sugar())
+	if err := notStarted.CollectNow(context.Background()); err == nil {
+		t.Fatalf(`expected error for collector which is not started`)
+	}
+
+	c, processor := newTestCollector(t, cachePath, collectTestMetrics)
+	registerTestMetrics(c)
+
+	// schedule of scheduled runs
+	nextScrapeTime := time.Now().Add(5 * time.Minute)
+	c.SetNextSleepDuration(5 * time.Minute)
+	c.nextScrapeTime = &nextScrapeTime
+
+	// concurrent calls are serialized
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.CollectNow(context.Background()); err != nil {
+				t.Errorf(`expected collect run to be successful, got: %v`, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if processor.collectCount != 2 {
+		t.Fatalf(`expected 2 collect runs, got %v`, processor.collectCount)
+	}
+	if val := testutil.ToFloat64(c.GetMetricList("gauge").vec.(*prometheus.GaugeVec).WithLabelValues("foo")); val != 42 {
+		t.Fatalf(`expected metric value 42, got %v`, val)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatalf(`expected cache to be written: %v`, err)
+	}
+	if sleepTime := c.scheduledSleepDuration(); sleepTime != 5*time.Minute {
+		t.Fatalf(`expected sleep duration of schedule to be unchanged, got %v`, sleepTime)
+	}
+	if next := c.GetNextScrapeTime(); next == nil || !next.Equal(nextScrapeTime) {
+		t.Fatalf(`expected next scrape time of schedule to be unchanged, got %v`, next)
+	}
+
+	// waits for running run until context is done
+	release, err := c.acquireRun(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.CollectNow(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf(`expected deadline exceeded error, got: %v`, err)
+	}
+	if processor.collectCount != 2 {
+		t.Fatalf(`expected no further collect run, got %v`, processor.collectCount)
+	}
+}
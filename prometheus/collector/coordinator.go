@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// ScrapeCoordinator coordinates expensive discoveries (eg. Azure resource lists) of multiple collectors,
+	// only one discovery per key is running at the same time and the result is shared with all waiting collectors
+	ScrapeCoordinator struct {
+		lock       sync.Mutex
+		ttl        time.Duration
+		calls      map[string]*scrapeCoordinatorCall
+		collectors map[string]*Collector
+	}
+
+	scrapeCoordinatorCall struct {
+		done     chan struct{}
+		result   interface{}
+		err      error
+		finished time.Time
+	}
+
+	// detachedContext keeps the values of the parent context but is never canceled (see ScrapeCoordinator.Do for deadline)
+	detachedContext struct {
+		parent context.Context
+	}
+)
+
+// NewScrapeCoordinator creates new scrape coordinator, successful discovery results are reused for ttl (0 only shares concurrent discoveries)
+func NewScrapeCoordinator(ttl time.Duration) *ScrapeCoordinator {
+	return &ScrapeCoordinator{
+		ttl:        ttl,
+		calls:      map[string]*scrapeCoordinatorCall{},
+		collectors: map[string]*Collector{},
+	}
+}
+
+// Register registers collector with scrape coordinator (see Processor.Coordinate)
+func (sc *ScrapeCoordinator) Register(collector *Collector) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.collectors[collector.Name] = collector
+	collector.scrapeCoordinator = sc
+}
+
+// GetCollectors returns registered collectors
+func (sc *ScrapeCoordinator) GetCollectors() map[string]*Collector {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	collectors := make(map[string]*Collector, len(sc.collectors))
+	for name, collector := range sc.collectors {
+		collectors[name] = collector
+	}
+	return collectors
+}
+
+// Do runs discovery for key if there is no running discovery (or reusable result), otherwise waits for the result of the running discovery
+//
+//	discovery is running with a context detached from the callers (values are kept), so canceling the first caller
+//	does not fail the discovery of the other callers; callers stop waiting if their context is canceled.
+//	deadline of the first caller (eg. collect timeout, see Collector.SetCollectTimeout) is kept for the discovery
+func (sc *ScrapeCoordinator) Do(ctx context.Context, key string, discovery func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	sc.lock.Lock()
+	sc.prune()
+
+	if call, exists := sc.calls[key]; exists {
+		select {
+		case <-call.done:
+			// discovery finished, reuse result if still valid
+			if call.err == nil && time.Since(call.finished) < sc.ttl {
+				sc.lock.Unlock()
+				return call.result, nil
+			}
+		default:
+			// discovery running, wait for result
+			sc.lock.Unlock()
+			return call.wait(ctx)
+		}
+	}
+
+	call := &scrapeCoordinatorCall{
+		done: make(chan struct{}),
+	}
+	sc.calls[key] = call
+	sc.lock.Unlock()
+
+	discoveryCtx, cancel := newDiscoveryContext(ctx)
+	go func() {
+		defer cancel()
+		sc.run(discoveryCtx, key, call, discovery)
+	}()
+
+	return call.wait(ctx)
+}
+
+// newDiscoveryContext returns context detached from ctx which keeps the deadline of ctx
+func newDiscoveryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detachedContext{ctx}, deadline)
+	}
+
+	return context.WithCancel(detachedContext{ctx})
+}
+
+// prune removes finished discoveries with expired results (lock needs to be held)
+func (sc *ScrapeCoordinator) prune() {
+	for key, call := range sc.calls {
+		select {
+		case <-call.done:
+			if time.Since(call.finished) >= sc.ttl {
+				delete(sc.calls, key)
+			}
+		default:
+		}
+	}
+}
+
+// run runs discovery and stores the result in call, panics of discovery are returned as error
+func (sc *ScrapeCoordinator) run(ctx context.Context, key string, call *scrapeCoordinatorCall, discovery func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			call.result = nil
+			call.err = fmt.Errorf(`caught panic while running discovery "%v": %v`, key, err)
+		}
+
+		sc.lock.Lock()
+		defer sc.lock.Unlock()
+
+		call.finished = time.Now()
+		if call.err != nil || sc.ttl <= 0 {
+			// result is not reusable
+			if sc.calls[key] == call {
+				delete(sc.calls, key)
+			}
+		}
+
+		close(call.done)
+	}()
+
+	call.result, call.err = discovery(ctx)
+}
+
+// wait waits for the result of call or until ctx is done
+func (call *scrapeCoordinatorCall) wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ScrapeCoordinatorSharesDiscovery(t *testing.T) {
+	sc := NewScrapeCoordinator(0)
+
+	var discoveryCount int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	discovery := func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt64(&discoveryCount, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "result", nil
+	}
+
+	results := make(chan interface{}, 5)
+	wg := sync.WaitGroup{}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, _ := sc.Do(context.Background(), "resources", discovery)
+		results <- result
+	}()
+	<-started
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, _ := sc.Do(context.Background(), "resources", discovery)
+			results <- result
+		}()
+	}
+
+	// wait until all callers are waiting for the running discovery
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if count := atomic.LoadInt64(&discoveryCount); count != 1 {
+		t.Fatalf(`expected discovery to be called once, got %v calls`, count)
+	}
+
+	for result := range results {
+		if result != "result" {
+			t.Fatalf(`expected shared result "result", got %v`, result)
+		}
+	}
+
+	// discovery finished and ttl is 0, so next call runs discovery again
+	if _, err := sc.Do(context.Background(), "resources", func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt64(&discoveryCount, 1)
+		return "result", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count := atomic.LoadInt64(&discoveryCount); count != 2 {
+		t.Fatalf(`expected discovery to be called again, got %v calls`, count)
+	}
+}
+
+func Test_ScrapeCoordinatorResultTtl(t *testing.T) {
+	sc := NewScrapeCoordinator(1 * time.Hour)
+
+	discoveryCount := 0
+	discovery := func(ctx context.Context) (interface{}, error) {
+		discoveryCount++
+		if discoveryCount == 1 {
+			return nil, fmt.Errorf(`discovery failed`)
+		}
+		return discoveryCount, nil
+	}
+
+	// failed discoveries are not reused
+	if _, err := sc.Do(context.Background(), "resources", discovery); err == nil {
+		t.Fatalf(`expected error of first discovery`)
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := sc.Do(context.Background(), "resources", discovery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != 2 {
+			t.Fatalf(`expected reused result 2, got %v`, result)
+		}
+	}
+
+	if result, _ := sc.Do(context.Background(), "other", discovery); result != 3 {
+		t.Fatalf(`expected separate discovery for other key, got %v`, result)
+	}
+}
+
+func Test_ScrapeCoordinatorPanic(t *testing.T) {
+	sc := NewScrapeCoordinator(1 * time.Hour)
+
+	// panicking discovery must not be cached as successful (nil) result
+	if result, err := sc.Do(context.Background(), "resources", func(ctx context.Context) (interface{}, error) {
+		panic("discovery failed")
+	}); err == nil {
+		t.Fatalf(`expected error of panicking discovery, got result %v`, result)
+	}
+
+	result, err := sc.Do(context.Background(), "resources", func(ctx context.Context) (interface{}, error) {
+		return "result", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "result" {
+		t.Fatalf(`expected discovery to run again after panic, got %v`, result)
+	}
+}
+
+func Test_ScrapeCoordinatorDetachedContext(t *testing.T) {
+	sc := NewScrapeCoordinator(0)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	discovery := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		// discovery must not be canceled by the first caller
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return "result", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := sc.Do(ctx, "resources", discovery)
+		firstErr <- err
+	}()
+	<-started
+
+	secondResult := make(chan interface{}, 1)
+	go func() {
+		result, _ := sc.Do(context.Background(), "resources", discovery)
+		secondResult <- result
+	}()
+
+	// first caller stops waiting, discovery continues for the second caller
+	cancel()
+	if err := <-firstErr; err == nil {
+		t.Fatalf(`expected canceled first caller to stop waiting`)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if result := <-secondResult; result != "result" {
+		t.Fatalf(`expected result of discovery for second caller, got %v`, result)
+	}
+}
+
+func Test_ScrapeCoordinatorDeadline(t *testing.T) {
+	sc := NewScrapeCoordinator(0)
+
+	// discovery is bounded by the deadline of the first caller (eg. collect timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	discoveryErr := make(chan error, 1)
+	_, err := sc.Do(ctx, "resources", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		discoveryErr <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	if err == nil {
+		t.Fatalf(`expected error for caller with exceeded deadline`)
+	}
+
+	select {
+	case err := <-discoveryErr:
+		if err != context.DeadlineExceeded {
+			t.Fatalf(`expected discovery context to exceed deadline, got %v`, err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf(`expected discovery context to be canceled after deadline of caller`)
+	}
+}
+
+func Test_ScrapeCoordinatorPrune(t *testing.T) {
+	sc := NewScrapeCoordinator(20 * time.Millisecond)
+
+	discovery := func(ctx context.Context) (interface{}, error) {
+		return "result", nil
+	}
+
+	for _, key := range []string{"resources", "resourcegroups"} {
+		if _, err := sc.Do(context.Background(), key, discovery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// expired results are removed on next call
+	time.Sleep(50 * time.Millisecond)
+	if _, err := sc.Do(context.Background(), "subscriptions", discovery); err != nil {
+		t.Fatal(err)
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if _, exists := sc.calls["resources"]; exists || len(sc.calls) != 1 {
+		t.Fatalf(`expected expired discoveries to be pruned, got %v discoveries`, len(sc.calls))
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/webdevops/go-common/utils/to"
+)
+
+type (
+	// CollectorDataView is a read-only view of collector data (eg. cache content read by ReadCache),
+	// it is the supported way to access cached data independent of the cache serialization
+	CollectorDataView struct {
+		data *CollectorData
+	}
+
+	// MetricListView is a read-only view of a metric list of collector data
+	MetricListView struct {
+		// Name is the metric name (empty if cache was written without metric descriptor)
+		Name string
+
+		// Help is the metric help text (empty if cache was written without metric descriptor)
+		Help string
+
+		// Type is the metric type (gauge, counter, histogram or summary; empty if cache was written without metric descriptor)
+		Type string
+
+		// Rows are the samples of the metric list
+		Rows []MetricRowView
+	}
+
+	// MetricRowView is a single sample of a metric list
+	MetricRowView struct {
+		Labels    map[string]string
+		Value     float64
+		Exemplar  map[string]string
+		Timestamp *time.Time
+	}
+)
+
+// ParseCollectorData parses cache content (eg. from ReadCache) into read-only view,
+// content with integrity envelope (see SetCacheIntegrityCheck) is verified and unwrapped
+//
+//	shard manifests (see SetCacheSharded) are rejected as they don't contain any metrics, use ReadCache to assemble the shards
+func ParseCollectorData(content []byte) (*CollectorDataView, error) {
+	content, err := cacheUnwrapIntegrity(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, isManifest := cacheParseShardManifest(content); isManifest {
+		return nil, fmt.Errorf(`unable to decode collector data: content is a shard manifest, metric list shards need to be assembled (see ReadCache)`)
+	}
+
+	data := NewCollectorData()
+	if err := json.Unmarshal(content, data); err != nil {
+		return nil, fmt.Errorf(`unable to decode collector data: %w`, err)
+	}
+
+	return data.View(), nil
+}
+
+// View returns read-only view of collector data
+func (d *CollectorData) View() *CollectorDataView {
+	return &CollectorDataView{data: d}
+}
+
+// Metrics returns copy of all metric lists (key is metric list name)
+func (v *CollectorDataView) Metrics() map[string]MetricListView {
+	list := make(map[string]MetricListView, len(v.data.Metrics))
+	for name, metricList := range v.data.Metrics {
+		if metricList == nil || metricList.MetricList == nil {
+			continue
+		}
+
+		view := MetricListView{
+			Rows: make([]MetricRowView, 0, len(metricList.List)),
+		}
+		if metricList.Desc != nil {
+			view.Name = metricList.Desc.Name
+			view.Help = metricList.Desc.Help
+			view.Type = metricList.Desc.Type
+		}
+
+		for _, row := range metricList.List {
+			rowView := MetricRowView{
+				Labels: copyStringMap(row.Labels),
+				Value:  row.Value,
+			}
+			if row.Exemplar != nil {
+				rowView.Exemplar = copyStringMap(row.Exemplar)
+			}
+			if row.Timestamp != nil {
+				timestamp := *row.Timestamp
+				rowView.Timestamp = &timestamp
+			}
+			view.Rows = append(view.Rows, rowView)
+		}
+
+		list[name] = view
+	}
+
+	return list
+}
+
+// CreatedAt returns creation time of the collector data (zero time if unknown)
+func (v *CollectorDataView) CreatedAt() time.Time {
+	if v.data.Created == nil {
+		return time.Time{}
+	}
+	return *v.data.Created
+}
+
+// ExpiresAt returns expiry time of the collector data (zero time if unknown)
+func (v *CollectorDataView) ExpiresAt() time.Time {
+	if v.data.Expiry == nil {
+		return time.Time{}
+	}
+	return *v.data.Expiry
+}
+
+// Tag returns cache tag of the collector data (empty if not set)
+func (v *CollectorDataView) Tag() string {
+	return to.String(v.data.Tag)
+}
+
+// copyStringMap returns copy of map (eg. labels)
+func copyStringMap(val map[string]string) map[string]string {
+	ret := make(map[string]string, len(val))
+	for key, value := range val {
+		ret[key] = value
+	}
+	return ret
+}
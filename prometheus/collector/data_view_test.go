@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testCollectorDataContent = `{
+	"metrics": {
+		"gauge": {
+			"list": [
+				{"labels": {"name": "foo"}, "value": 42, "timestamp": "2023-05-01T12:00:00Z"},
+				{"labels": {"name": "bar"}, "value": 1.5, "exemplar": {"trace_id": "abc"}}
+			],
+			"desc": {"name": "test_gauge", "help": "test gauge", "type": "gauge"}
+		},
+		"legacy": {
+			"list": [{"labels": {"name": "foo"}, "value": 3}]
+		}
+	},
+	"data": {},
+	"created": "2023-05-01T12:00:00Z",
+	"expiry": "2023-05-01T13:00:00Z",
+	"tag": "v1"
+}`
+
+func Test_CollectorDataView(t *testing.T) {
+	view, err := ParseCollectorData([]byte(testCollectorDataContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created := view.CreatedAt(); !created.Equal(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf(`unexpected created time %v`, created)
+	}
+	if expiry := view.ExpiresAt(); !expiry.Equal(time.Date(2023, 5, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Fatalf(`unexpected expiry time %v`, expiry)
+	}
+	if tag := view.Tag(); tag != "v1" {
+		t.Fatalf(`unexpected tag "%v"`, tag)
+	}
+
+	metrics := view.Metrics()
+	if len(metrics) != 2 {
+		t.Fatalf(`expected 2 metric lists, got %v`, len(metrics))
+	}
+
+	gauge := metrics["gauge"]
+	if gauge.Name != "test_gauge" || gauge.Help != "test gauge" || gauge.Type != MetricTypeGauge {
+		t.Fatalf(`unexpected metric descriptor %+v`, gauge)
+	}
+	if len(gauge.Rows) != 2 {
+		t.Fatalf(`expected 2 rows, got %v`, len(gauge.Rows))
+	}
+	for _, row := range gauge.Rows {
+		switch row.Labels["name"] {
+		case "foo":
+			if row.Value != 42 || row.Timestamp == nil || !row.Timestamp.Equal(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)) {
+				t.Fatalf(`unexpected row %+v`, row)
+			}
+		case "bar":
+			if row.Value != 1.5 || row.Timestamp != nil || row.Exemplar["trace_id"] != "abc" {
+				t.Fatalf(`unexpected row %+v`, row)
+			}
+		default:
+			t.Fatalf(`unexpected row %+v`, row)
+		}
+	}
+
+	// cache without metric descriptor
+	if legacy := metrics["legacy"]; legacy.Name != "" || len(legacy.Rows) != 1 || legacy.Rows[0].Value != 3 {
+		t.Fatalf(`unexpected metric list %+v`, legacy)
+	}
+
+	// views are copies and don't modify collector data
+	gauge.Rows[0].Labels["name"] = "modified"
+	if name := view.Metrics()["gauge"].Rows[0].Labels["name"]; name == "modified" {
+		t.Fatalf(`expected metric list view to be a copy`)
+	}
+}
+
+func Test_CollectorDataViewIntegrity(t *testing.T) {
+	// cache content is always written compact
+	compactContent := bytes.Buffer{}
+	if err := json.Compact(&compactContent, []byte(testCollectorDataContent)); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := cacheAddIntegrity(compactContent.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := ParseCollectorData(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag := view.Tag(); tag != "v1" {
+		t.Fatalf(`unexpected tag "%v"`, tag)
+	}
+
+	if _, err := ParseCollectorData([]byte("invalid")); err == nil {
+		t.Fatalf(`expected error for invalid content`)
+	}
+
+	// shard manifests don't contain metrics and need to be assembled
+	manifest, err := cacheAddIntegrity([]byte(`{"data":{},"tag":"v1","shards":{"gauge":"abc"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCollectorData(manifest); err == nil {
+		t.Fatalf(`expected error for shard manifest`)
+	}
+}
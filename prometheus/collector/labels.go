@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	armclient "github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	// labelValueTruncateMarker is appended to truncated label values (see Collector.SetMaxLabelValueLength)
+	labelValueTruncateMarker = "…"
+)
+
+// AzureResourceLabels returns consistent prometheus labels (subscriptionID, resourceGroup, resourceName, resourceType) from Azure resourceID
+//
+//	labels are empty if resourceID cannot be parsed
+func AzureResourceLabels(resourceID string) prometheus.Labels {
+	labels := prometheus.Labels{
+		"subscriptionID": "",
+		"resourceGroup":  "",
+		"resourceName":   "",
+		"resourceType":   "",
+	}
+
+	if resourceInfo, err := armclient.ParseResourceId(resourceID); err == nil {
+		labels["subscriptionID"] = resourceInfo.Subscription
+		labels["resourceGroup"] = resourceInfo.ResourceGroup
+		labels["resourceName"] = resourceInfo.ResourceName
+		labels["resourceType"] = resourceInfo.ResourceType
+	}
+
+	return labels
+}
+
+// truncateLabelValue truncates label value to maxLength characters (incl. truncate marker)
+func truncateLabelValue(value string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(value) <= maxLength {
+		return value
+	}
+
+	runes := []rune(value)
+	return string(runes[:maxLength-1]) + labelValueTruncateMarker
+}
+
+// truncateLabels returns labels with truncated label values (labels are copied if truncation is needed)
+func truncateLabels(labels prometheus.Labels, maxLength int) prometheus.Labels {
+	var ret prometheus.Labels
+	for name, value := range labels {
+		if truncated := truncateLabelValue(value, maxLength); truncated != value {
+			if ret == nil {
+				ret = make(prometheus.Labels, len(labels))
+				for name, value := range labels {
+					ret[name] = value
+				}
+			}
+			ret[name] = truncated
+		}
+	}
+
+	if ret == nil {
+		return labels
+	}
+	return ret
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_AzureResourceLabels(t *testing.T) {
+	resourceIds := map[string]prometheus.Labels{
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318": {
+			"subscriptionID": "d7b0cf13-ddf7-43ea-81f1-6f659767a318",
+			"resourceGroup":  "",
+			"resourceName":   "",
+			"resourceType":   "",
+		},
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/FOO-rg": {
+			"subscriptionID": "d7b0cf13-ddf7-43ea-81f1-6f659767a318",
+			"resourceGroup":  "foo-rg",
+			"resourceName":   "",
+			"resourceType":   "",
+		},
+		"/subscriptions/d7b0cf13-ddf7-43ea-81f1-6f659767a318/resourceGroups/FOO-rg/providers/Microsoft.Network/routeTables/testroute": {
+			"subscriptionID": "d7b0cf13-ddf7-43ea-81f1-6f659767a318",
+			"resourceGroup":  "foo-rg",
+			"resourceName":   "testroute",
+			"resourceType":   "microsoft.network/routetables",
+		},
+		"invalid": {
+			"subscriptionID": "",
+			"resourceGroup":  "",
+			"resourceName":   "",
+			"resourceType":   "",
+		},
+	}
+
+	for resourceId, expected := range resourceIds {
+		labels := AzureResourceLabels(resourceId)
+		if len(labels) != len(expected) {
+			t.Fatalf(`expected %v labels for "%s", got %v`, len(expected), resourceId, len(labels))
+		}
+
+		for name, value := range expected {
+			if labels[name] != value {
+				t.Errorf(`expected label "%s" to be "%s" for "%s", got "%s"`, name, value, resourceId, labels[name])
+			}
+		}
+	}
+}
+
+func Test_TruncateLabels(t *testing.T) {
+	values := map[string]string{
+		"":            "",
+		"foo":         "foo",
+		"foobar":      "foobar",
+		"foobarbaz":   "fooba…",
+		"äöüäöüäöü":   "äöüäö…",
+		"foo bar baz": "foo b…",
+	}
+
+	for value, expected := range values {
+		if truncated := truncateLabelValue(value, 6); truncated != expected {
+			t.Fatalf(`expected "%v" for "%v", got "%v"`, expected, value, truncated)
+		}
+	}
+
+	labels := prometheus.Labels{"name": "foobarbaz", "type": "foo"}
+	truncated := truncateLabels(labels, 6)
+	if truncated["name"] != "fooba…" || truncated["type"] != "foo" {
+		t.Fatalf(`unexpected truncated labels: %v`, truncated)
+	}
+	if labels["name"] != "foobarbaz" {
+		t.Fatalf(`expected original labels not to be modified, got: %v`, labels)
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	// logSamplingCore wraps the logger core of the collector, so log sampling (see Collector.SetLogSampling) also applies
+	// to loggers derived before sampling was enabled (eg. loggers stored by processors)
+	logSamplingCore struct {
+		// unsampled core (incl. fields)
+		zapcore.Core
+
+		// sampling is shared by the collector core and all derived cores
+		sampling *logSampling
+
+		// fields added by With since the collector core
+		fields []zapcore.Field
+
+		// sampled core (with fields) for the current sampler
+		sampledLock    sync.Mutex
+		sampledSampler zapcore.Core
+		sampled        zapcore.Core
+	}
+
+	// logSampling holds the sampler core wrapping the collector core (nil if sampling is disabled)
+	logSampling struct {
+		lock    sync.RWMutex
+		sampler zapcore.Core
+	}
+)
+
+// newLogSamplingCore wraps collector core, sampling is disabled until a sampler is set
+func newLogSamplingCore(core zapcore.Core) *logSamplingCore {
+	return &logSamplingCore{
+		Core:     core,
+		sampling: &logSampling{},
+	}
+}
+
+// setSampler sets sampler core wrapping the collector core (nil disables sampling)
+func (s *logSampling) setSampler(sampler zapcore.Core) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sampler = sampler
+}
+
+// getSampler returns sampler core (nil if sampling is disabled)
+func (s *logSampling) getSampler() zapcore.Core {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sampler
+}
+
+// With implements zapcore.Core
+func (c *logSamplingCore) With(fields []zapcore.Field) zapcore.Core {
+	derivedFields := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	derivedFields = append(derivedFields, c.fields...)
+	derivedFields = append(derivedFields, fields...)
+
+	return &logSamplingCore{
+		Core:     c.Core.With(fields),
+		sampling: c.sampling,
+		fields:   derivedFields,
+	}
+}
+
+// Check implements zapcore.Core, entries are checked by the sampler if sampling is enabled
+func (c *logSamplingCore) Check(entry zapcore.Entry, checkedEntry *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	sampler := c.sampling.getSampler()
+	if sampler == nil {
+		return c.Core.Check(entry, checkedEntry)
+	}
+
+	return c.sampledCore(sampler).Check(entry, checkedEntry)
+}
+
+// sampledCore returns sampler core with fields of this core (sampler counters are shared with all derived cores)
+func (c *logSamplingCore) sampledCore(sampler zapcore.Core) zapcore.Core {
+	c.sampledLock.Lock()
+	defer c.sampledLock.Unlock()
+
+	if c.sampled == nil || c.sampledSampler != sampler {
+		c.sampledSampler = sampler
+		c.sampled = sampler
+		if len(c.fields) > 0 {
+			c.sampled = sampler.With(c.fields)
+		}
+	}
+
+	return c.sampled
+}
@@ -1,14 +1,500 @@
 package collector
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
 	prometheusCommon "github.com/webdevops/go-common/prometheus"
 )
 
+const (
+	// staleMetricSuffix is the suffix of the metric name of stale samples (see Collector.SetStaleMarking)
+	staleMetricSuffix = "_stale"
+)
+
+const (
+	MetricTypeGauge     = "gauge"
+	MetricTypeCounter   = "counter"
+	MetricTypeHistogram = "histogram"
+	MetricTypeSummary   = "summary"
+)
+
 type (
 	MetricList struct {
 		*prometheusCommon.MetricList
 
-		vec   interface{}
-		reset bool
+		Desc *MetricDesc `json:"desc,omitempty"`
+
+		vec            interface{}
+		fqName         string
+		variableLabels []string
+		reset          bool
+		ephemeral      bool
+
+		timestampLock sync.RWMutex
+		timestamps    map[string]time.Time
+
+		staleLock    sync.RWMutex
+		staleSamples map[string]staleSample
+		staleRun     time.Time
+	}
+
+	// NativeHistogramOpts configures native histograms (see RegisterNativeHistogramMetricList)
+	NativeHistogramOpts struct {
+		// BucketFactor is the growth factor between native buckets (needs to be greater than 1, default 1.1)
+		BucketFactor float64
+
+		// MaxBucketNumber limits the number of native buckets (0 is unlimited)
+		MaxBucketNumber uint32
+
+		// MinResetDuration is the minimum duration between resets if bucket limit is reached
+		MinResetDuration time.Duration
+
+		// ZeroThreshold is the width of the zero bucket (0 uses prometheus default)
+		ZeroThreshold float64
+
+		// ClassicBuckets enables additional classic buckets for compatibility
+		ClassicBuckets bool
+	}
+
+	// staleSample is the last seen sample of a series (see Collector.SetStaleMarking)
+	staleSample struct {
+		labels prometheus.Labels
+		value  float64
+		seen   time.Time
+	}
+
+	// metricListCollector wraps metric vec and adds explicit sample timestamps (see MetricList.AddWithTimestamp)
+	metricListCollector struct {
+		metricList *MetricList
+		vec        prometheus.Collector
+
+		// descriptor of metric vec
+		fqName         string
+		help           string
+		constLabels    prometheus.Labels
+		variableLabels []string
+
+		// staleDesc is the descriptor of stale samples (see Collector.SetStaleMarking)
+		staleDesc *prometheus.Desc
+	}
+
+	// MetricDesc is the metric descriptor which is stored in cache together with the samples
+	//
+	//	name, help and label names are only available if the metric list was registered with opts (eg. RegisterGaugeMetricList)
+	MetricDesc struct {
+		Name   string   `json:"name"`
+		Help   string   `json:"help"`
+		Type   string   `json:"type"`
+		Labels []string `json:"labels,omitempty"`
 	}
 )
+
+// newMetricDesc builds metric descriptor from registration opts and label names
+func newMetricDesc(metricType string, opts prometheus.Opts, labels []string) *MetricDesc {
+	labelNames := make([]string, len(labels))
+	copy(labelNames, labels)
+	sort.Strings(labelNames)
+
+	return &MetricDesc{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   metricType,
+		Labels: labelNames,
+	}
+}
+
+// newMetricDescFromVec builds metric descriptor (only type) from prometheus metric vec
+func newMetricDescFromVec(vec interface{}) *MetricDesc {
+	switch vec.(type) {
+	case *prometheus.GaugeVec:
+		return &MetricDesc{Type: MetricTypeGauge}
+	case *prometheus.CounterVec:
+		return &MetricDesc{Type: MetricTypeCounter}
+	case *prometheus.HistogramVec:
+		return &MetricDesc{Type: MetricTypeHistogram}
+	case *prometheus.SummaryVec:
+		return &MetricDesc{Type: MetricTypeSummary}
+	default:
+		return nil
+	}
+}
+
+// matches checks if restored metric descriptor matches the registered metric descriptor,
+// name and label names are only compared if both descriptors contain them
+func (desc *MetricDesc) matches(registered *MetricDesc) bool {
+	if desc == nil || registered == nil {
+		// old cache without metric descriptor
+		return true
+	}
+
+	if desc.Type != registered.Type {
+		return false
+	}
+
+	if desc.Name != "" && registered.Name != "" && desc.Name != registered.Name {
+		return false
+	}
+
+	if desc.Labels != nil && registered.Labels != nil && strings.Join(desc.Labels, "\xff") != strings.Join(registered.Labels, "\xff") {
+		return false
+	}
+
+	return true
+}
+
+// metricName returns metric name (without prefix) from metric descriptor or metric vec,
+// falls back to name of metric list if not available
+func (m *MetricList) metricName(name string) string {
+	switch {
+	case m.Desc != nil && m.Desc.Name != "":
+		return m.Desc.Name
+	case m.fqName != "":
+		return m.fqName
+	default:
+		return name
+	}
+}
+
+// updateTimestamps updates explicit sample timestamps from metric list rows,
+// without reset only timestamps of series which are still available in the metric vec are kept
+func (m *MetricList) updateTimestamps() {
+	m.timestampLock.Lock()
+	defer m.timestampLock.Unlock()
+
+	// map is replaced as it is read without lock during collect (see metricListCollector.collectVec)
+	timestamps := map[string]time.Time{}
+	if !m.reset && !m.ephemeral && len(m.timestamps) > 0 {
+		series := m.seriesKeys()
+		for key, timestamp := range m.timestamps {
+			if _, exists := series[key]; exists {
+				timestamps[key] = timestamp
+			}
+		}
+	}
+
+	for _, row := range m.GetList() {
+		key := metricLabelKey(row.Labels)
+		if row.Timestamp != nil {
+			timestamps[key] = *row.Timestamp
+		} else {
+			// series was replaced by sample without timestamp
+			delete(timestamps, key)
+		}
+	}
+
+	m.timestamps = timestamps
+}
+
+// seriesKeys returns label keys (see dtoMetricLabelKey) of all series of the metric vec
+func (m *MetricList) seriesKeys() map[string]struct{} {
+	keys := map[string]struct{}{}
+
+	collector, ok := m.vec.(prometheus.Collector)
+	if !ok {
+		return keys
+	}
+
+	metricChannel := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metricChannel)
+		close(metricChannel)
+	}()
+
+	for metric := range metricChannel {
+		dtoMetric := dto.Metric{}
+		if err := metric.Write(&dtoMetric); err == nil {
+			keys[dtoMetricLabelKey(&dtoMetric, m.variableLabels)] = struct{}{}
+		}
+	}
+
+	return keys
+}
+
+// getTimestamps returns explicit sample timestamps (key is label key, see metricLabelKey)
+func (m *MetricList) getTimestamps() map[string]time.Time {
+	m.timestampLock.RLock()
+	defer m.timestampLock.RUnlock()
+
+	return m.timestamps
+}
+
+// apply sets native histogram options to histogram options
+func (native NativeHistogramOpts) apply(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	opts.NativeHistogramBucketFactor = native.BucketFactor
+	if opts.NativeHistogramBucketFactor <= 1 {
+		opts.NativeHistogramBucketFactor = 1.1
+	}
+	opts.NativeHistogramMaxBucketNumber = native.MaxBucketNumber
+	opts.NativeHistogramMinResetDuration = native.MinResetDuration
+	opts.NativeHistogramZeroThreshold = native.ZeroThreshold
+
+	if native.ClassicBuckets {
+		if len(opts.Buckets) == 0 {
+			opts.Buckets = prometheus.DefBuckets
+		}
+	} else {
+		// without classic buckets only native buckets are exposed
+		opts.Buckets = nil
+	}
+
+	return opts
+}
+
+// SetEphemeral marks metric list as ephemeral, metrics are reset on each run (independent of reset setting),
+// not stored in and not restored from cache and not stale marked (eg. gauges of resources which might be deleted)
+func (m *MetricList) SetEphemeral(val bool) *MetricList {
+	m.ephemeral = val
+	return m
+}
+
+// updateStaleSamples remembers samples of current run (at now) and removes samples not seen within grace period,
+// only supported for (non ephemeral) gauges with reset enabled
+func (m *MetricList) updateStaleSamples(now time.Time, grace time.Duration) {
+	if m.Desc == nil || m.Desc.Type != MetricTypeGauge || !m.reset || m.ephemeral {
+		return
+	}
+
+	m.staleLock.Lock()
+	defer m.staleLock.Unlock()
+
+	if m.staleSamples == nil {
+		m.staleSamples = map[string]staleSample{}
+	}
+
+	for _, row := range m.GetList() {
+		m.staleSamples[metricLabelKey(row.Labels)] = staleSample{
+			labels: row.Labels,
+			value:  row.Value,
+			seen:   now,
+		}
+	}
+
+	for key, sample := range m.staleSamples {
+		if now.Sub(sample.seen) > grace {
+			delete(m.staleSamples, key)
+		}
+	}
+
+	m.staleRun = now
+}
+
+// getStaleSamples returns samples which were not produced by the last run (but within grace period)
+func (m *MetricList) getStaleSamples() []staleSample {
+	m.staleLock.RLock()
+	defer m.staleLock.RUnlock()
+
+	list := []staleSample{}
+	for _, sample := range m.staleSamples {
+		if sample.seen.Before(m.staleRun) {
+			list = append(list, sample)
+		}
+	}
+	return list
+}
+
+// metricLabelKey builds unique key for label set
+func metricLabelKey(labels prometheus.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for name, value := range labels {
+		keys = append(keys, name+"="+value)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\xff")
+}
+
+// dtoMetricLabelKey builds unique key for label set of metric (see metricLabelKey), only variable labels are used
+// as const labels are not part of the metric list rows (all labels are used if variable labels are not known)
+func dtoMetricLabelKey(metric *dto.Metric, variableLabels []string) string {
+	labels := prometheus.Labels{}
+	for _, label := range metric.Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	if variableLabels != nil {
+		rowLabels := make(prometheus.Labels, len(variableLabels))
+		for _, name := range variableLabels {
+			rowLabels[name] = labels[name]
+		}
+		labels = rowLabels
+	}
+
+	return metricLabelKey(labels)
+}
+
+// newMetricListCollector wraps metric vec, fully-qualified name, help and labels are taken from the
+// descriptor of the metric vec (also available for metric lists registered with RegisterMetricList)
+func newMetricListCollector(metricList *MetricList, vec prometheus.Collector) (*metricListCollector, error) {
+	mc := &metricListCollector{
+		metricList: metricList,
+		vec:        vec,
+	}
+
+	descChannel := make(chan *prometheus.Desc, 1)
+	go func() {
+		vec.Describe(descChannel)
+		close(descChannel)
+	}()
+
+	var desc *prometheus.Desc
+	for val := range descChannel {
+		if desc == nil {
+			desc = val
+		}
+	}
+
+	if desc == nil {
+		return mc, fmt.Errorf(`metric vec does not describe any metric`)
+	}
+
+	var err error
+	mc.fqName, mc.help, mc.constLabels, mc.variableLabels, err = parseMetricDesc(desc)
+	if err != nil {
+		return mc, err
+	}
+
+	if metricList.Desc != nil && metricList.Desc.Type == MetricTypeGauge {
+		mc.staleDesc = prometheus.NewDesc(mc.fqName+staleMetricSuffix, mc.help+" (stale series)", mc.variableLabels, mc.constLabels)
+	}
+
+	return mc, nil
+}
+
+// parseMetricDesc parses fully-qualified name, help, const labels and variable label names from the string
+// representation of the metric descriptor, prometheus.Desc does not expose them otherwise
+func parseMetricDesc(desc *prometheus.Desc) (fqName string, help string, constLabels prometheus.Labels, variableLabels []string, err error) {
+	val := desc.String()
+
+	unquote := func(prefix string) (string, error) {
+		if !strings.HasPrefix(val, prefix) {
+			return "", fmt.Errorf(`unable to parse metric descriptor "%v"`, desc.String())
+		}
+		val = val[len(prefix):]
+
+		quoted, err := strconv.QuotedPrefix(val)
+		if err != nil {
+			return "", fmt.Errorf(`unable to parse metric descriptor "%v": %w`, desc.String(), err)
+		}
+		val = val[len(quoted):]
+
+		return strconv.Unquote(quoted)
+	}
+
+	if fqName, err = unquote(`Desc{fqName: `); err != nil {
+		return
+	}
+
+	if help, err = unquote(`, help: `); err != nil {
+		return
+	}
+
+	if !strings.HasPrefix(val, `, constLabels: {`) {
+		return "", "", nil, nil, fmt.Errorf(`unable to parse metric descriptor "%v"`, desc.String())
+	}
+	val = val[len(`, constLabels: {`):]
+
+	constLabels = prometheus.Labels{}
+	for !strings.HasPrefix(val, "}") {
+		val = strings.TrimPrefix(val, ",")
+
+		pos := strings.Index(val, "=")
+		if pos <= 0 {
+			return "", "", nil, nil, fmt.Errorf(`unable to parse metric descriptor "%v"`, desc.String())
+		}
+		name := val[:pos]
+		val = val[pos:]
+
+		value, err := unquote("=")
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+		constLabels[name] = value
+	}
+
+	if !strings.HasPrefix(val, `}, variableLabels: [`) || !strings.HasSuffix(val, `]}`) {
+		return "", "", nil, nil, fmt.Errorf(`unable to parse metric descriptor "%v"`, desc.String())
+	}
+	val = strings.TrimSuffix(strings.TrimPrefix(val, `}, variableLabels: [`), `]}`)
+
+	// variable labels are label names or constrained labels ({name constraint}), label names cannot contain spaces
+	variableLabels = []string{}
+	constrained := false
+	for _, field := range strings.Fields(val) {
+		switch {
+		case constrained:
+			constrained = !strings.HasSuffix(field, "}")
+		case strings.HasPrefix(field, "{"):
+			variableLabels = append(variableLabels, field[1:])
+			constrained = true
+		default:
+			variableLabels = append(variableLabels, field)
+		}
+	}
+
+	return fqName, help, constLabels, variableLabels, nil
+}
+
+// Describe implements prometheus.Collector
+func (mc *metricListCollector) Describe(ch chan<- *prometheus.Desc) {
+	mc.vec.Describe(ch)
+
+	if mc.staleDesc != nil {
+		ch <- mc.staleDesc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (mc *metricListCollector) Collect(ch chan<- prometheus.Metric) {
+	mc.collectVec(ch)
+	mc.collectStale(ch)
+}
+
+// collectVec collects metrics of vec, samples with explicit timestamps are emitted with their timestamp
+func (mc *metricListCollector) collectVec(ch chan<- prometheus.Metric) {
+	timestamps := mc.metricList.getTimestamps()
+	if len(timestamps) == 0 {
+		mc.vec.Collect(ch)
+		return
+	}
+
+	metricChannel := make(chan prometheus.Metric)
+	go func() {
+		mc.vec.Collect(metricChannel)
+		close(metricChannel)
+	}()
+
+	for metric := range metricChannel {
+		dtoMetric := dto.Metric{}
+		if err := metric.Write(&dtoMetric); err == nil {
+			if timestamp, exists := timestamps[dtoMetricLabelKey(&dtoMetric, mc.variableLabels)]; exists {
+				metric = prometheus.NewMetricWithTimestamp(timestamp, metric)
+			}
+		}
+		ch <- metric
+	}
+}
+
+// collectStale emits stale samples (see Collector.SetStaleMarking) as separate metric <name>_stale
+func (mc *metricListCollector) collectStale(ch chan<- prometheus.Metric) {
+	if mc.staleDesc == nil {
+		return
+	}
+
+	for _, sample := range mc.metricList.getStaleSamples() {
+		labelValues := make([]string, 0, len(mc.variableLabels))
+		for _, name := range mc.variableLabels {
+			labelValues = append(labelValues, sample.labels[name])
+		}
+
+		if metric, err := prometheus.NewConstMetric(mc.staleDesc, prometheus.GaugeValue, sample.value, labelValues...); err == nil {
+			ch <- metric
+		}
+	}
+}
@@ -4,6 +4,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	errorStageCollect    = "collect"
+	errorStageCacheRead  = "cache_read"
+	errorStageCacheWrite = "cache_write"
+)
+
 var (
 	metricInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -45,6 +51,16 @@ var (
 		},
 	)
 
+	metricScrapeSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_scrape_success",
+			Help: "Collector scrape success status of last collect run or cache restore (1 if successful, 0 if failed)",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
 	metricLastCollect = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "collector_collect_timestamp_seconds",
@@ -54,6 +70,99 @@ var (
 			"collector",
 		},
 	)
+
+	metricLastCacheRestore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_cache_restore_timestamp_seconds",
+			Help: "Collector last successful cache restore timestamp",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCacheRestoreAge = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "collector_cache_restore_age_seconds",
+			Help:    "Collector cache age (time since cache creation) at successful cache restore",
+			Buckets: []float64{30, 60, 300, 600, 1800, 3600, 7200, 14400, 28800, 86400},
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCacheExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_cache_expiry_timestamp_seconds",
+			Help: "Collector cache expiry timestamp",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCacheCreated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_cache_created_timestamp_seconds",
+			Help: "Collector cache created timestamp",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCacheTagMismatch = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_cache_tag_mismatch",
+			Help: "Collector cache tag mismatch count",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCollectTimeout = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_collect_timeouts",
+			Help: "Collector collect run timeout count",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricCacheBackendUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_cache_backend_up",
+			Help: "Collector cache backend status (1 if last read/store attempt was successful)",
+		},
+		[]string{
+			"collector",
+			"protocol",
+		},
+	)
+
+	metricLogDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_log_messages_dropped",
+			Help: "Collector log messages dropped by log sampling",
+		},
+		[]string{
+			"collector",
+		},
+	)
+
+	metricErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_errors",
+			Help: "Collector error count by stage (collect, cache_read, cache_write)",
+		},
+		[]string{
+			"collector",
+			"stage",
+		},
+	)
 )
 
 func init() {
@@ -62,6 +171,16 @@ func init() {
 		metricPanicCount,
 		metricDuration,
 		metricSuccess,
+		metricScrapeSuccess,
 		metricLastCollect,
+		metricLastCacheRestore,
+		metricCacheRestoreAge,
+		metricCacheExpiry,
+		metricCacheCreated,
+		metricCacheTagMismatch,
+		metricCollectTimeout,
+		metricErrors,
+		metricCacheBackendUp,
+		metricLogDropped,
 	)
 }
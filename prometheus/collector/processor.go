@@ -29,7 +29,8 @@ func (p *Processor) Logger() *zap.SugaredLogger {
 }
 
 func (p *Processor) Context() context.Context {
-	return p.Collector.context
+	// context of current collect run (eg. with timeout)
+	return p.Collector.currentContext()
 }
 
 func (p *Processor) WaitGroup() *sizedwaitgroup.SizedWaitGroup {
@@ -39,3 +40,13 @@ func (p *Processor) WaitGroup() *sizedwaitgroup.SizedWaitGroup {
 func (p *Processor) GetLastScapeTime() *time.Time {
 	return p.Collector.GetLastScapeTime()
 }
+
+// Coordinate runs discovery via scrape coordinator of collector (see ScrapeCoordinator.Do),
+// discovery is called directly if collector is not registered at a scrape coordinator
+func (p *Processor) Coordinate(key string, discovery func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if p.Collector.scrapeCoordinator == nil {
+		return discovery(p.Context())
+	}
+
+	return p.Collector.scrapeCoordinator.Do(p.Context(), key, discovery)
+}
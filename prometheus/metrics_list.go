@@ -1,8 +1,10 @@
 package prometheus
 
 import (
+	"regexp"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	cache "github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,9 +12,15 @@ import (
 	"github.com/webdevops/go-common/utils/to"
 )
 
+var (
+	exemplarLabelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
 type MetricRow struct {
-	Labels prometheus.Labels `json:"labels"`
-	Value  float64           `json:"value"`
+	Labels    prometheus.Labels `json:"labels"`
+	Value     float64           `json:"value"`
+	Exemplar  prometheus.Labels `json:"exemplar,omitempty"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
 }
 
 type MetricList struct {
@@ -79,6 +87,20 @@ func (m *MetricList) Add(labels prometheus.Labels, value float64) {
 	m.append(MetricRow{Labels: labels, Value: value})
 }
 
+// AddWithExemplar adds metric with exemplar (eg. trace_id), exemplar is only used for counters and histograms,
+// invalid exemplars (invalid label names or more than 128 runes) are dropped and the metric is added without exemplar
+func (m *MetricList) AddWithExemplar(value float64, labels, exemplar prometheus.Labels) {
+	if !isValidExemplar(exemplar) {
+		exemplar = nil
+	}
+	m.append(MetricRow{Labels: labels, Value: value, Exemplar: exemplar})
+}
+
+// AddWithTimestamp adds metric with explicit timestamp (eg. timestamp from source data)
+func (m *MetricList) AddWithTimestamp(labels prometheus.Labels, value float64, timestamp time.Time) {
+	m.append(MetricRow{Labels: labels, Value: value, Timestamp: &timestamp})
+}
+
 func (m *MetricList) AddInfo(labels prometheus.Labels) {
 	m.append(MetricRow{Labels: labels, Value: 1})
 }
@@ -163,12 +185,35 @@ func (m *MetricList) SummarySet(summary *prometheus.SummaryVec) {
 
 func (m *MetricList) HistogramSet(histogram *prometheus.HistogramVec) {
 	for _, metric := range m.GetList() {
-		histogram.With(metric.Labels).Observe(metric.Value)
+		observer := histogram.With(metric.Labels)
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && len(metric.Exemplar) > 0 && isValidExemplar(metric.Exemplar) {
+			exemplarObserver.ObserveWithExemplar(metric.Value, metric.Exemplar)
+		} else {
+			observer.Observe(metric.Value)
+		}
 	}
 }
 
 func (m *MetricList) CounterAdd(counter *prometheus.CounterVec) {
 	for _, metric := range m.GetList() {
-		counter.With(metric.Labels).Add(metric.Value)
+		metricCounter := counter.With(metric.Labels)
+		if exemplarAdder, ok := metricCounter.(prometheus.ExemplarAdder); ok && len(metric.Exemplar) > 0 && isValidExemplar(metric.Exemplar) {
+			exemplarAdder.AddWithExemplar(metric.Value, metric.Exemplar)
+		} else {
+			metricCounter.Add(metric.Value)
+		}
+	}
+}
+
+// isValidExemplar returns true if exemplar would be accepted by prometheus client (otherwise adding it panics)
+func isValidExemplar(exemplar prometheus.Labels) bool {
+	runes := 0
+	for name, value := range exemplar {
+		if !exemplarLabelNameRegexp.MatchString(name) || !utf8.ValidString(value) {
+			return false
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
 	}
+
+	return runes <= prometheus.ExemplarMaxRunes
 }
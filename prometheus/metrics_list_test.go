@@ -1,11 +1,13 @@
 package prometheus
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	cache "github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func Test_MetricsList(t *testing.T) {
@@ -133,3 +135,52 @@ func expectMetricRowValue(t *testing.T, m MetricRow, expectedValue float64) {
 		t.Errorf("Expected metric value: %v  Actual metric value: %v", expectedValue, m.Value)
 	}
 }
+
+func Test_MetricsListExemplar(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_counter", Help: "test"}, []string{"name"})
+
+	m := NewMetricsList()
+	m.AddWithExemplar(5, prometheus.Labels{"name": "foo"}, prometheus.Labels{"trace_id": "abc"})
+	m.CounterAdd(counter)
+
+	metric := dto.Metric{}
+	if err := counter.WithLabelValues("foo").(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+
+	if metric.Counter.GetValue() != 5 {
+		t.Fatalf(`expected counter value 5, got %v`, metric.Counter.GetValue())
+	}
+
+	exemplar := metric.Counter.GetExemplar()
+	if exemplar == nil || len(exemplar.Label) != 1 || exemplar.Label[0].GetValue() != "abc" {
+		t.Fatalf(`expected exemplar with trace_id "abc", got %v`, exemplar)
+	}
+}
+
+func Test_MetricsListInvalidExemplar(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_counter", Help: "test"}, []string{"name"})
+
+	m := NewMetricsList()
+	m.AddWithExemplar(5, prometheus.Labels{"name": "foo"}, prometheus.Labels{"trace_id": strings.Repeat("a", prometheus.ExemplarMaxRunes)})
+	m.AddWithExemplar(2, prometheus.Labels{"name": "foo"}, prometheus.Labels{"invalid-name": "abc"})
+
+	// restored rows (eg. from cache) are not validated while adding
+	m.append(MetricRow{Labels: prometheus.Labels{"name": "foo"}, Value: 1, Exemplar: prometheus.Labels{"trace_id": strings.Repeat("a", prometheus.ExemplarMaxRunes)}})
+
+	// must not panic, invalid exemplars are dropped
+	m.CounterAdd(counter)
+
+	metric := dto.Metric{}
+	if err := counter.WithLabelValues("foo").(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+
+	if metric.Counter.GetValue() != 8 {
+		t.Fatalf(`expected counter value 8, got %v`, metric.Counter.GetValue())
+	}
+
+	if exemplar := metric.Counter.GetExemplar(); exemplar != nil {
+		t.Fatalf(`expected invalid exemplars to be dropped, got %v`, exemplar)
+	}
+}